@@ -0,0 +1,15 @@
+package soseg
+
+import "math/rand"
+
+// BuildRandomTree builds a tree with n entries for benchmarking.
+// The keys 0..n-1 are inserted in random order with random weights in [1, 100],
+// both derived from seed so that runs are reproducible.
+func BuildRandomTree(n int, seed int64) *Tree {
+	r := rand.New(rand.NewSource(seed))
+	tree := new(Tree)
+	for _, key := range r.Perm(n) {
+		tree.Put(key, r.Intn(100)+1)
+	}
+	return tree
+}
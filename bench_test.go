@@ -0,0 +1,162 @@
+package soseg
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+var benchSizes = []int{1e3, 1e5, 1e6}
+
+func benchSizesRun(b *testing.B, sizes []int, fn func(b *testing.B, n int)) {
+	for _, n := range sizes {
+		b.Run(fmt.Sprintf("n=%d", n), func(b *testing.B) {
+			b.ReportAllocs()
+			fn(b, n)
+		})
+	}
+}
+
+func BenchmarkPutRandom(b *testing.B) {
+	benchSizesRun(b, benchSizes, func(b *testing.B, n int) {
+		tree := BuildRandomTree(n, 1)
+		r := rand.New(rand.NewSource(2))
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			tree.Put(r.Intn(2*n), 1)
+		}
+	})
+}
+
+// Sorted inserts degrade the unbalanced tree into a list,
+// so the sizes are kept small enough to finish.
+func BenchmarkPutSorted(b *testing.B) {
+	benchSizesRun(b, []int{1e3, 1e4}, func(b *testing.B, n int) {
+		for i := 0; i < b.N; i++ {
+			var tree Tree
+			for key := 0; key < n; key++ {
+				tree.Put(key, 1)
+			}
+		}
+	})
+}
+
+func BenchmarkGet(b *testing.B) {
+	benchSizesRun(b, benchSizes, func(b *testing.B, n int) {
+		tree := BuildRandomTree(n, 1)
+		r := rand.New(rand.NewSource(2))
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			tree.Get(r.Intn(n))
+		}
+	})
+}
+
+func BenchmarkFind(b *testing.B) {
+	benchSizesRun(b, benchSizes, func(b *testing.B, n int) {
+		tree := BuildRandomTree(n, 1)
+		r := rand.New(rand.NewSource(2))
+		total := tree.Total()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			tree.Find(r.Intn(total))
+		}
+	})
+}
+
+func BenchmarkRemove(b *testing.B) {
+	benchSizesRun(b, benchSizes, func(b *testing.B, n int) {
+		var tree *Tree
+		var keys []int
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if len(keys) == 0 {
+				b.StopTimer()
+				tree = BuildRandomTree(n, int64(i))
+				keys = rand.New(rand.NewSource(int64(i))).Perm(n)
+				b.StartTimer()
+			}
+			tree.Remove(keys[0])
+			keys = keys[1:]
+		}
+	})
+}
+
+func BenchmarkBuildAndSample(b *testing.B) {
+	benchSizesRun(b, benchSizes, func(b *testing.B, n int) {
+		r := rand.New(rand.NewSource(2))
+		for i := 0; i < b.N; i++ {
+			tree := BuildRandomTree(n, int64(i))
+			total := tree.Total()
+			for j := 0; j < n; j++ {
+				tree.Find(r.Intn(total))
+			}
+		}
+	})
+}
+
+func BenchmarkRefillClear(b *testing.B) {
+	benchRefill(b, (*Tree).Clear)
+}
+
+func BenchmarkRefillClearRetain(b *testing.B) {
+	benchRefill(b, (*Tree).ClearRetain)
+}
+
+func benchRefill(b *testing.B, clear func(t *Tree)) {
+	benchSizesRun(b, []int{1e3, 1e5}, func(b *testing.B, n int) {
+		keys := rand.New(rand.NewSource(1)).Perm(n)
+		var tree Tree
+		for i := 0; i < b.N; i++ {
+			for _, key := range keys {
+				tree.Put(key, 1)
+			}
+			clear(&tree)
+		}
+	})
+}
+
+// BenchmarkContains compares misses outside [Min, Max],
+// which return without a descent, to lookups that have to descend.
+func BenchmarkContains(b *testing.B) {
+	benchSizesRun(b, benchSizes, func(b *testing.B, n int) {
+		tree := BuildRandomTree(n, 1)
+		b.Run("inside", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				tree.Contains(i % n)
+			}
+		})
+		b.Run("outside", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				tree.Contains(n + i%n)
+			}
+		})
+	})
+}
+
+func BenchmarkFindFrozen(b *testing.B) {
+	benchSizesRun(b, benchSizes, func(b *testing.B, n int) {
+		tree := BuildRandomTree(n, 1).Freeze()
+		r := rand.New(rand.NewSource(2))
+		total := tree.Total()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			tree.Find(r.Intn(total))
+		}
+	})
+}
+
+func BenchmarkFindBalanced(b *testing.B) {
+	tree := BuildRandomTree(1e5, 1)
+	tree.Rebuild()
+	r := rand.New(rand.NewSource(2))
+	points := make([]int, 1024)
+	for i := range points {
+		points[i] = r.Intn(tree.Total())
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tree.Find(points[i%len(points)])
+	}
+}
@@ -0,0 +1,91 @@
+package soseg
+
+import (
+	"encoding"
+	"encoding/binary"
+	"math"
+)
+
+var (
+	_ encoding.BinaryMarshaler   = (*Tree)(nil)
+	_ encoding.BinaryUnmarshaler = (*Tree)(nil)
+)
+
+// binaryVersion is the first byte of the binary format.
+// It is followed by the number of entries as uvarint,
+// then for each entry in key order the difference to the previous key
+// (the first key itself) as varint and the size as uvarint.
+const binaryVersion = 1
+
+// MarshalBinary encodes the entries of the tree,
+// including keys with zero weight left by SoftRemove.
+// Equal trees encode to the same bytes regardless of their shape.
+func (t *Tree) MarshalBinary() ([]byte, error) {
+	buf := make([]byte, 0, 1+binary.MaxVarintLen64*(1+2*t.size))
+	buf = append(buf, binaryVersion)
+	buf = binary.AppendUvarint(buf, uint64(t.size))
+	var prev int
+	t.each(func(key, size int) bool {
+		buf = binary.AppendVarint(buf, int64(key-prev))
+		buf = binary.AppendUvarint(buf, uint64(size))
+		prev = key
+		return true
+	})
+	return buf, nil
+}
+
+// UnmarshalBinary replaces the contents of the tree with the decoded entries,
+// building a balanced tree. The tree is left unchanged on error.
+func (t *Tree) UnmarshalBinary(data []byte) error {
+	if len(data) == 0 || data[0] != binaryVersion {
+		return errorf(ErrCorrupt, "soseg: binary: unknown format")
+	}
+	data = data[1:]
+	count, n := binary.Uvarint(data)
+	if n <= 0 {
+		return errorf(ErrCorrupt, "soseg: binary: invalid entry count")
+	}
+	data = data[n:]
+	// Each entry takes at least two bytes
+	if count > uint64(len(data)/2) {
+		return errorf(ErrCorrupt, "soseg: binary: truncated, %d entries announced", count)
+	}
+
+	entries := make([]Entry, 0, count)
+	var key, total int
+	for i := uint64(0); i < count; i++ {
+		delta, n := binary.Varint(data)
+		if n <= 0 {
+			return errorf(ErrCorrupt, "soseg: binary: invalid key of entry %d", i)
+		}
+		data = data[n:]
+		size, n := binary.Uvarint(data)
+		if n <= 0 || size > uint64(math.MaxInt-total) {
+			return errorf(ErrCorrupt, "soseg: binary: invalid size of entry %d", i)
+		}
+		data = data[n:]
+		total += int(size)
+
+		key += int(delta)
+		if i > 0 && !t.lt(entries[i-1].Key, key) {
+			return errorf(ErrCorrupt, "soseg: binary: key %d out of order", key)
+		}
+		entries = append(entries, Entry{Key: key, Size: int(size)})
+	}
+	if len(data) != 0 {
+		return errorf(ErrCorrupt, "soseg: binary: %d trailing bytes", len(data))
+	}
+	t.replace(entries)
+	return nil
+}
+
+// replace is like build but also records the replacement in the changelog.
+func (t *Tree) replace(entries []Entry) {
+	if t.Root != nil {
+		t.record(Op{Kind: OpClear})
+	}
+	t.build(entries)
+	for _, e := range entries {
+		t.record(Op{Kind: OpPut, Key: e.Key, Size: e.Size})
+	}
+}
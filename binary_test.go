@@ -0,0 +1,51 @@
+package soseg
+
+import (
+	"github.com/magiconair/properties/assert"
+	"testing"
+)
+
+func TestTree_MarshalBinary(t *testing.T) {
+	tree := BuildRandomTree(1000, 1)
+	tree.Put(-500, 3)
+	data, err := tree.MarshalBinary()
+	assert.Equal(t, err, nil, "Could not marshal")
+
+	var decoded Tree
+	assert.Equal(t, decoded.UnmarshalBinary(data), nil, "Could not unmarshal")
+	assert.Equal(t, decoded.Entries(), tree.Entries(), "Entries differ after round trip")
+
+	// The balanced rebuild has a different shape but the same bytes
+	tree.Rebuild()
+	again, _ := tree.MarshalBinary()
+	assert.Equal(t, again, data, "Encoding depends on shape")
+
+	// Soft-removed keys keep their zero weight
+	tree.SoftRemove(500)
+	data, _ = tree.MarshalBinary()
+	assert.Equal(t, decoded.UnmarshalBinary(data), nil, "Could not unmarshal soft-removed key")
+	assert.Equal(t, decoded.Equal(tree), true, "Trees differ after round trip with soft-removed key")
+	assert.Equal(t, decoded.DeadKeys(), []int{500}, "Soft-removed key lost")
+
+	var empty Tree
+	data, _ = empty.MarshalBinary()
+	assert.Equal(t, decoded.UnmarshalBinary(data), nil, "Could not unmarshal empty tree")
+	assert.Equal(t, decoded.Empty(), true, "Decoded empty tree not empty")
+}
+
+func TestTree_UnmarshalBinaryGarbage(t *testing.T) {
+	var tree Tree
+	tree.Put(1, 2)
+	for _, data := range [][]byte{
+		nil,
+		{0xff, 1, 2, 3},
+		{binaryVersion},
+		{binaryVersion, 0xff, 0xff, 0xff},
+		{binaryVersion, 2, 2, 1},
+		{binaryVersion, 2, 2, 1, 0, 1},
+		{binaryVersion, 1, 2, 1, 7},
+	} {
+		assert.Equal(t, tree.UnmarshalBinary(data) != nil, true, "Accepted garbage")
+	}
+	assert.Equal(t, tree.Total(), 2, "Tree changed by failed unmarshal")
+}
@@ -0,0 +1,84 @@
+package soseg
+
+// OpKind is the kind of mutation recorded in a changelog.
+type OpKind uint8
+
+const (
+	// OpPut sets the weight of Key to Size, which is zero for a key removed by SoftRemove.
+	OpPut OpKind = iota
+	// OpRemove removes Key.
+	OpRemove
+	// OpPutRange sets the weight of all keys in [Key, Last] to Size like PutRange.
+	OpPutRange
+	// OpClear removes all keys.
+	OpClear
+	// OpRename moves the weight Size of Key to the key Last like Rename.
+	OpRename
+)
+
+// Op is a single mutation recorded in a changelog.
+type Op struct {
+	Kind OpKind
+	Key  int
+	Last int
+	Size int
+}
+
+// EnableChangelog starts recording all mutations of the tree as ops,
+// so that a replica can follow incrementally with ApplyOps.
+// Mutations that leave the entries unchanged are not recorded.
+func (t *Tree) EnableChangelog() {
+	t.logging = true
+}
+
+// DrainChangelog returns the ops recorded since the last call and clears them.
+func (t *Tree) DrainChangelog() []Op {
+	ops := t.changelog
+	t.changelog = nil
+	return ops
+}
+
+// Version returns a counter that every mutation changing the entries increments,
+// whether or not the changelog is enabled.
+// The entries are unchanged as long as the version is, unless Root is modified directly.
+func (t *Tree) Version() uint64 {
+	return t.version
+}
+
+// ApplyOps applies ops from the changelog of another tree in order.
+// It stops at the first invalid op and returns an error,
+// leaving the preceding ops applied.
+func (t *Tree) ApplyOps(ops []Op) error {
+	for i, op := range ops {
+		switch op.Kind {
+		case OpPut:
+			if op.Size < 0 {
+				return errorf(ErrNonPositiveWeight, "soseg: op %d: negative size %d for key %d", i, op.Size, op.Key)
+			}
+			t.Put(op.Key, op.Size)
+		case OpRemove:
+			t.Remove(op.Key)
+		case OpPutRange:
+			if err := t.PutRange(op.Key, op.Last, op.Size); err != nil {
+				return err
+			}
+		case OpClear:
+			t.Clear()
+		case OpRename:
+			if err := t.Rename(op.Key, op.Last); err != nil {
+				return err
+			}
+		default:
+			return errorf(ErrCorrupt, "soseg: op %d: unknown kind %d", i, op.Kind)
+		}
+	}
+	return nil
+}
+
+// record counts a mutation and appends op to the changelog if it is enabled.
+func (t *Tree) record(op Op) {
+	t.version++
+	if t.logging {
+		t.changelog = append(t.changelog, op)
+	}
+}
@@ -0,0 +1,53 @@
+package soseg
+
+import (
+	"github.com/magiconair/properties/assert"
+	"testing"
+)
+
+func TestTree_Changelog(t *testing.T) {
+	tree := BuildRandomTree(100, 1)
+	replica := tree.Clone()
+	tree.EnableChangelog()
+
+	// No-op mutations are not recorded
+	{
+		size, _, _ := tree.Get(5)
+		tree.Put(5, size)
+		tree.Remove(1000)
+		tree.AdjustWeight(6, 0)
+		tree.Rebuild()
+		assert.Equal(t, len(tree.DrainChangelog()), 0, "Recorded no-op mutations")
+	}
+
+	tree.Put(1000, 7)
+	tree.Put(5, 3)
+	tree.Remove(6)
+	tree.AdjustWeight(7, 2)
+	tree.SwapWeights(8, 9)
+	tree.SoftRemove(10)
+	tree.Rename(11, 2000)
+	tree.PutRange(3000, 3009, 4)
+	tree.Put(3005, 1)
+	tree.PowTransform(2)
+	tree.RemoveBatch([]int{12, 13, 3001})
+	tree.RemoveBatch([]int{20, 21, 22, 23, 24, 25, 26, 27, 28, 29, 30, 31, 32, 33, 34, 35, 3002, 3003, 3004, 3005, 3006, 3007, 3008, 3009, 3010, 3011, 3012, 3013})
+	tree.Normalize(100000)
+	ops := tree.DrainChangelog()
+	assert.Equal(t, replica.ApplyOps(ops), nil, "Could not apply ops")
+	assert.Equal(t, replica.Equal(tree), true, "Replica differs after applying ops")
+	assert.Equal(t, len(tree.DrainChangelog()), 0, "Changelog not cleared")
+
+	tree.Compact()
+	tree.Clear()
+	tree.Put(1, 1)
+	assert.Equal(t, replica.ApplyOps(tree.DrainChangelog()), nil, "Could not apply ops")
+	assert.Equal(t, replica.Equal(tree), true, "Replica differs after clear")
+
+	{
+		err := replica.ApplyOps([]Op{{Kind: OpPut, Key: 1, Size: -1}})
+		assert.Equal(t, err != nil, true, "Applied negative size")
+		err = replica.ApplyOps([]Op{{Kind: 99}})
+		assert.Equal(t, err != nil, true, "Applied unknown op")
+	}
+}
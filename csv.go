@@ -0,0 +1,91 @@
+package soseg
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+)
+
+var csvHeader = []string{"key", "size"}
+
+// WriteCSV writes a "key,size" header followed by one row per entry in key order,
+// including keys with zero weight left by SoftRemove.
+func (t *Tree) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader); err != nil {
+		return err
+	}
+	var err error
+	t.each(func(key, size int) bool {
+		err = cw.Write([]string{strconv.Itoa(key), strconv.Itoa(size)})
+		return err == nil
+	})
+	if err != nil {
+		return err
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// ReadCSV parses the output of WriteCSV into a balanced tree.
+// Rows may appear in any order.
+func ReadCSV(r io.Reader) (*Tree, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = len(csvHeader)
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, errorf(ErrCorrupt, "soseg: csv: missing header")
+	} else if err != nil {
+		return nil, csvError(err)
+	}
+	if header[0] != csvHeader[0] || header[1] != csvHeader[1] {
+		return nil, errorf(ErrCorrupt, "soseg: csv: unexpected header %q", header)
+	}
+
+	var entries []Entry
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, csvError(err)
+		}
+		line, _ := cr.FieldPos(0)
+		key, err := strconv.Atoi(record[0])
+		if err != nil {
+			return nil, errorf(ErrCorrupt, "soseg: csv: line %d: invalid key %q", line, record[0])
+		}
+		size, err := strconv.Atoi(record[1])
+		if err != nil {
+			return nil, errorf(ErrCorrupt, "soseg: csv: line %d: invalid size %q", line, record[1])
+		}
+		if size < 0 {
+			return nil, errorf(ErrNonPositiveWeight, "soseg: csv: line %d: negative size %d", line, size)
+		}
+		entries = append(entries, Entry{Key: key, Size: size})
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Key < entries[j].Key
+	})
+	for i := 1; i < len(entries); i++ {
+		if entries[i].Key == entries[i-1].Key {
+			return nil, errorf(ErrDuplicateKey, "soseg: csv: duplicate key %d", entries[i].Key)
+		}
+	}
+	t := new(Tree)
+	t.build(entries)
+	return t, nil
+}
+
+// csvError wraps an error of the csv reader, which is corrupt if a row could not be parsed.
+func csvError(err error) error {
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		return errorf(ErrCorrupt, "soseg: csv: %w", err)
+	}
+	return fmt.Errorf("soseg: csv: %w", err)
+}
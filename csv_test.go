@@ -0,0 +1,60 @@
+package soseg
+
+import (
+	"bytes"
+	"github.com/magiconair/properties/assert"
+	"strings"
+	"testing"
+)
+
+func TestTree_CSV(t *testing.T) {
+	var tree Tree
+	tree.Put(4, 2)
+	tree.Put(0, 1)
+	tree.Put(3, 1)
+	tree.Put(-1, 3)
+	tree.Put(2, 4)
+
+	var buf bytes.Buffer
+	assert.Equal(t, tree.WriteCSV(&buf), nil, "Could not write CSV")
+	assert.Equal(t, buf.String(), "key,size\n-1,3\n0,1\n2,4\n3,1\n4,2\n", "Wrong CSV output")
+
+	read, err := ReadCSV(&buf)
+	assert.Equal(t, err, nil, "Could not read CSV")
+	assert.Equal(t, read.Size(), tree.Size(), "Wrong number of nodes")
+	assert.Equal(t, read.Total(), tree.Total(), "Wrong total amount")
+	for point := 0; point < tree.Total(); point++ {
+		want, _ := tree.FindEntry(point)
+		got, _ := read.FindEntry(point)
+		assert.Equal(t, got, want, "Entry differs after round trip")
+	}
+
+	// Soft-removed keys keep their zero weight
+	tree.SoftRemove(2)
+	buf.Reset()
+	assert.Equal(t, tree.WriteCSV(&buf), nil, "Could not write CSV")
+	read, err = ReadCSV(&buf)
+	assert.Equal(t, err, nil, "Could not read soft-removed key")
+	assert.Equal(t, read.Equal(&tree), true, "Round trip changed soft-removed key")
+}
+
+func TestReadCSV_Malformed(t *testing.T) {
+	for _, c := range []struct {
+		input string
+		err   string
+	}{
+		{"", "soseg: csv: missing header"},
+		{"id,weight\n", `soseg: csv: unexpected header ["id" "weight"]`},
+		{"key,size\n1\n", "soseg: csv: record on line 2: wrong number of fields"},
+		{"key,size\nx,1\n", `soseg: csv: line 2: invalid key "x"`},
+		{"key,size\n1,y\n", `soseg: csv: line 2: invalid size "y"`},
+		{"key,size\n1,2\n2,-1\n", "soseg: csv: line 3: negative size -1"},
+		{"key,size\n1,2\n3,1\n1,4\n", "soseg: csv: duplicate key 1"},
+	} {
+		_, err := ReadCSV(strings.NewReader(c.input))
+		if err == nil {
+			t.Fatalf("No error for %q", c.input)
+		}
+		assert.Equal(t, err.Error(), c.err, "Wrong error")
+	}
+}
@@ -0,0 +1,57 @@
+package soseg
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Errors returned by the tree, which can be matched with errors.Is.
+// The returned errors describe the failure in more detail.
+var (
+	// ErrEmpty is returned for operations that need at least one key.
+	ErrEmpty = errors.New("soseg: empty tree")
+	// ErrOutOfRange is returned for arguments outside of their valid range.
+	ErrOutOfRange = errors.New("soseg: out of range")
+	// ErrNonPositiveWeight is returned if a weight is or would become zero or negative.
+	ErrNonPositiveWeight = errors.New("soseg: non-positive weight")
+	// ErrDuplicateKey is returned if a key already exists or is listed twice.
+	ErrDuplicateKey = errors.New("soseg: duplicate key")
+	// ErrOverflow is returned if a weight or the total would overflow.
+	ErrOverflow = errors.New("soseg: overflow")
+	// ErrNotFound is returned if a key does not exist.
+	ErrNotFound = errors.New("soseg: key not found")
+	// ErrCorrupt is returned for corrupted trees and malformed encodings.
+	ErrCorrupt = errors.New("soseg: corrupt")
+	// ErrUnsupported is returned for operations that the tree configuration does not support.
+	ErrUnsupported = errors.New("soseg: unsupported")
+)
+
+// kindError is a detailed error matching one of the package errors
+// and any error wrapped with %w.
+type kindError struct {
+	kind error
+	err  error
+}
+
+func (e *kindError) Error() string {
+	return e.err.Error()
+}
+
+// Unwrap returns kind followed by the errors wrapped with %w, if any,
+// leaving out nil like errors.Join.
+func (e *kindError) Unwrap() []error {
+	switch err := e.err.(type) {
+	case interface{ Unwrap() error }:
+		if inner := err.Unwrap(); inner != nil {
+			return []error{e.kind, inner}
+		}
+	case interface{ Unwrap() []error }:
+		return append([]error{e.kind}, err.Unwrap()...)
+	}
+	return []error{e.kind}
+}
+
+// errorf formats an error like fmt.Errorf that also matches kind with errors.Is.
+func errorf(kind error, format string, args ...any) error {
+	return &kindError{kind: kind, err: fmt.Errorf(format, args...)}
+}
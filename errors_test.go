@@ -0,0 +1,79 @@
+package soseg
+
+import (
+	"encoding/csv"
+	"errors"
+	"github.com/magiconair/properties/assert"
+	"io"
+	"math"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestErrors(t *testing.T) {
+	var tree Tree
+	tree.Put(0, 1)
+	tree.Put(1, 2)
+	corrupt := tree.Clone()
+	corrupt.Root.Value = 7
+
+	_, sampleErr := new(Tree).SampleSecure()
+	_, _, getErr := tree.SafeGet(5)
+	_, _, corruptErr := corrupt.SafeGet(1)
+	_, csvErr := ReadCSV(strings.NewReader("key,size\n1,-1\n"))
+	_, csvRowErr := ReadCSV(strings.NewReader("key,size\n1,2,3\n"))
+	_, csvQuoteErr := ReadCSV(strings.NewReader("key,size\n\"1,2\n"))
+	_, dupErr := NewFromEntries([]Entry{{Key: 1, Size: 1}, {Key: 1, Size: 1}})
+	_, quantizeErr := QuantizeWeights([]float64{math.Inf(1)}, 1)
+	for _, c := range []struct {
+		err  error
+		kind error
+	}{
+		{sampleErr, ErrEmpty},
+		{new(Tree).Normalize(1), ErrEmpty},
+		{tree.Normalize(-1), ErrOutOfRange},
+		{tree.PutRange(5, 4, 1), ErrOutOfRange},
+		{tree.PutRange(5, 6, 0), ErrNonPositiveWeight},
+		{tree.PutRange(5, 6, math.MaxInt), ErrOverflow},
+		{quantizeErr, ErrOverflow},
+		{tree.Rename(0, 1), ErrDuplicateKey},
+		{dupErr, ErrDuplicateKey},
+		{tree.Rename(5, 6), ErrNotFound},
+		{getErr, ErrNotFound},
+		{corruptErr, ErrCorrupt},
+		{tree.UnmarshalBinary([]byte{0}), ErrCorrupt},
+		{csvErr, ErrNonPositiveWeight},
+		{csvRowErr, ErrCorrupt},
+		{csvQuoteErr, ErrCorrupt},
+		{NewWithLess(func(a, b int) bool { return a > b }).PutRange(0, 1, 1), ErrUnsupported},
+	} {
+		assert.Equal(t, c.err != nil, true, "Missing error")
+		assert.Equal(t, errors.Is(c.err, c.kind), true, "Wrong error kind: "+c.err.Error())
+	}
+	assert.Equal(t, errors.Is(getErr, ErrCorrupt), false, "Error matches wrong kind")
+	assert.Equal(t, getErr.Error(), "soseg: key 5 not found", "Wrong error message")
+	{
+		var parseErr *csv.ParseError
+		assert.Equal(t, errors.As(csvRowErr, &parseErr), true, "Csv error not wrapped")
+		_, ioErr := ReadCSV(iotest.ErrReader(io.ErrUnexpectedEOF))
+		assert.Equal(t, errors.Is(ioErr, io.ErrUnexpectedEOF), true, "Read error not wrapped")
+		assert.Equal(t, errors.Is(ioErr, ErrCorrupt), false, "Read error is corrupt")
+	}
+
+	// Unwrap lists only the errors that are actually wrapped
+	for _, c := range []struct {
+		err  error
+		want int
+	}{
+		{getErr, 1},
+		{csvRowErr, 2},
+		{errorf(ErrCorrupt, "soseg: %w and %w", io.EOF, io.ErrUnexpectedEOF), 3},
+	} {
+		wrapped := c.err.(interface{ Unwrap() []error }).Unwrap()
+		assert.Equal(t, len(wrapped), c.want, "Wrong number of wrapped errors")
+		for _, err := range wrapped {
+			assert.Equal(t, err != nil, true, "Unwrapped nil error")
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package soseg
+
+import "container/list"
+
+// EnableFindCache makes Find remember the keys of up to size recently found points,
+// evicting the least recently used, so that repeatedly queried points are found in O(1).
+// Any mutation of the entries invalidates the whole cache.
+// Lookups write to the cache, so concurrent reads are not safe
+// while the cache is enabled. A size <= 0 disables the cache.
+func (t *Tree) EnableFindCache(size int) {
+	if size <= 0 {
+		t.cache = nil
+		return
+	}
+	t.cache = &findCache{size: size, version: t.version, items: make(map[int]*list.Element, size)}
+}
+
+// findCache is an LRU cache of found keys by point for a single version of a tree.
+type findCache struct {
+	size    int
+	version uint64
+	items   map[int]*list.Element
+	order   list.List // of findCacheEntry, most recently used first
+}
+
+type findCacheEntry struct {
+	point, key int
+}
+
+// get returns the cached key of point,
+// clearing the cache first if the tree changed since version.
+func (c *findCache) get(point int, version uint64) (key int, ok bool) {
+	if c.version != version {
+		clear(c.items)
+		c.order.Init()
+		c.version = version
+		return 0, false
+	}
+	e, ok := c.items[point]
+	if !ok {
+		return 0, false
+	}
+	c.order.MoveToFront(e)
+	return e.Value.(findCacheEntry).key, true
+}
+
+// put caches the key of point, evicting the least recently used point if full.
+func (c *findCache) put(point, key int) {
+	if c.order.Len() >= c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(findCacheEntry).point)
+	}
+	c.items[point] = c.order.PushFront(findCacheEntry{point: point, key: key})
+}
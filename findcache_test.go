@@ -0,0 +1,64 @@
+package soseg
+
+import (
+	"github.com/magiconair/properties/assert"
+	"testing"
+)
+
+func TestTree_EnableFindCache(t *testing.T) {
+	var tree Tree
+	tree.Put(0, 2)
+	tree.Put(1, 3)
+	tree.Put(2, 5)
+	tree.EnableFindCache(2)
+	tree.SetStepCounting(true)
+
+	{
+		key, ok := tree.Find(4)
+		assert.Equal(t, ok, true, "Not found on miss")
+		assert.Equal(t, key, 1, "Wrong key on miss")
+		assert.Equal(t, tree.LastOpSteps() > 0, true, "Miss did not descend")
+		key, ok = tree.Find(4)
+		assert.Equal(t, ok, true, "Not found on hit")
+		assert.Equal(t, key, 1, "Wrong key on hit")
+		assert.Equal(t, tree.LastOpSteps(), 0, "Hit descended")
+	}
+
+	// The least recently used point is evicted
+	tree.Find(9)
+	tree.Find(4)
+	tree.Find(0)
+	assert.Equal(t, len(tree.cache.items), 2, "Cache exceeds size")
+	tree.Find(9)
+	assert.Equal(t, tree.LastOpSteps() > 0, true, "Evicted point still cached")
+	tree.Find(0)
+	assert.Equal(t, tree.LastOpSteps(), 0, "Recent point not cached")
+
+	// Mutations invalidate stale keys, lookups that leave the entries alone do not
+	version := tree.Version()
+	tree.Put(2, 5)
+	tree.Rebuild()
+	assert.Equal(t, tree.Version(), version, "Version changed without mutation")
+	tree.Put(0, 5)
+	assert.Equal(t, tree.Version() > version, true, "Version not incremented")
+	{
+		key, _ := tree.Find(4)
+		assert.Equal(t, key, 0, "Stale key returned after mutation")
+		key, _ = tree.Find(9)
+		assert.Equal(t, key, 2, "Stale key returned after mutation")
+	}
+	tree.Remove(0)
+	{
+		key, _ := tree.Find(0)
+		assert.Equal(t, key, 1, "Stale key returned after removal")
+		_, ok := tree.Find(9)
+		assert.Equal(t, ok, false, "Stale key returned for point out of range")
+	}
+
+	tree.EnableFindCache(0)
+	assert.Equal(t, tree.cache == nil, true, "Cache not disabled")
+	{
+		key, _ := tree.Find(3)
+		assert.Equal(t, key, 2, "Wrong key without cache")
+	}
+}
@@ -0,0 +1,101 @@
+package soseg
+
+import (
+	"math"
+	"sort"
+)
+
+// FrozenTree is an immutable, array-backed version of a Tree.
+// Keys, sizes and running offsets are stored in flat slices,
+// so lookups binary search contiguous memory instead of chasing pointers.
+type FrozenTree struct {
+	keys    []int
+	sizes   []int
+	offsets []int // offsets[i] is the start of range i, offsets[len(keys)] the total
+	less    func(a, b int) bool
+}
+
+var _ Reader = (*FrozenTree)(nil)
+
+// Freeze returns an immutable copy of the tree in O(n).
+func (t *Tree) Freeze() *FrozenTree {
+	f := &FrozenTree{
+		keys:    make([]int, 0, t.size),
+		sizes:   make([]int, 0, t.size),
+		offsets: make([]int, 1, t.size+1),
+		less:    t.less,
+	}
+	var offset int
+	t.each(func(key, size int) bool {
+		offset += size
+		f.keys = append(f.keys, key)
+		f.sizes = append(f.sizes, size)
+		f.offsets = append(f.offsets, offset)
+		return true
+	})
+	return f
+}
+
+// ViewSorted returns a FrozenTree over the caller's keys and sizes in O(n)
+// without copying them. Only the running offsets are allocated.
+// The keys must be strictly ascending and the sizes positive.
+// Modifying the slices afterwards invalidates the view.
+func ViewSorted(keys, sizes []int) (*FrozenTree, error) {
+	if len(keys) != len(sizes) {
+		return nil, errorf(ErrOutOfRange, "soseg: %d keys but %d sizes", len(keys), len(sizes))
+	}
+	offsets := make([]int, len(keys)+1)
+	for i, size := range sizes {
+		switch {
+		case size <= 0:
+			return nil, errorf(ErrNonPositiveWeight, "soseg: non-positive size %d for key %d", size, keys[i])
+		case i > 0 && keys[i] == keys[i-1]:
+			return nil, errorf(ErrDuplicateKey, "soseg: duplicate key %d", keys[i])
+		case i > 0 && keys[i] < keys[i-1]:
+			return nil, errorf(ErrOutOfRange, "soseg: key %d not sorted after key %d", keys[i], keys[i-1])
+		case size > math.MaxInt-offsets[i]:
+			return nil, errorf(ErrOverflow, "soseg: total overflows at key %d", keys[i])
+		}
+		offsets[i+1] = offsets[i] + size
+	}
+	return &FrozenTree{keys: keys, sizes: sizes, offsets: offsets}, nil
+}
+
+// Get is the frozen version of Tree.Get in O(log n).
+func (f *FrozenTree) Get(key int) (size int, offset int, ok bool) {
+	i := sort.Search(len(f.keys), func(i int) bool {
+		return !f.lt(f.keys[i], key)
+	})
+	if i == len(f.keys) || f.keys[i] != key {
+		return 0, 0, false
+	}
+	return f.sizes[i], f.offsets[i], true
+}
+
+// Find is the frozen version of Tree.Find in O(log n).
+func (f *FrozenTree) Find(point int) (key int, ok bool) {
+	if point < 0 || point >= f.Total() {
+		return 0, false
+	}
+	i := sort.Search(len(f.keys), func(i int) bool {
+		return f.offsets[i+1] > point
+	})
+	return f.keys[i], true
+}
+
+// Total is the frozen version of Tree.Total.
+func (f *FrozenTree) Total() int {
+	return f.offsets[len(f.keys)]
+}
+
+// Size is the frozen version of Tree.Size.
+func (f *FrozenTree) Size() int {
+	return len(f.keys)
+}
+
+func (f *FrozenTree) lt(a, b int) bool {
+	if f.less == nil {
+		return a < b
+	}
+	return f.less(a, b)
+}
@@ -0,0 +1,76 @@
+package soseg
+
+import (
+	"github.com/magiconair/properties/assert"
+	"math"
+	"testing"
+)
+
+func TestTree_Freeze(t *testing.T) {
+	tree := BuildRandomTree(100, 1)
+	frozen := tree.Freeze()
+	assert.Equal(t, frozen.Total(), tree.Total(), "Wrong total amount")
+	assert.Equal(t, frozen.Size(), tree.Size(), "Wrong number of nodes")
+
+	for point := -1; point <= tree.Total(); point++ {
+		wantKey, wantOk := tree.Find(point)
+		key, ok := frozen.Find(point)
+		assert.Equal(t, ok, wantOk, "Find differs from tree")
+		assert.Equal(t, key, wantKey, "Find differs from tree")
+	}
+	for key := -1; key <= 100; key++ {
+		wantSize, wantOffset, wantOk := tree.Get(key)
+		size, offset, ok := frozen.Get(key)
+		assert.Equal(t, ok, wantOk, "Get differs from tree")
+		assert.Equal(t, size, wantSize, "Get differs from tree")
+		assert.Equal(t, offset, wantOffset, "Get differs from tree")
+	}
+
+	tree.Put(7, 1000)
+	{
+		size, _, _ := frozen.Get(7)
+		assert.Equal(t, size == 1000, false, "Frozen tree changed by mutation")
+	}
+
+	var empty Tree
+	{
+		_, ok := empty.Freeze().Find(0)
+		assert.Equal(t, ok, false, "Found point in empty frozen tree")
+	}
+}
+
+func TestViewSorted(t *testing.T) {
+	tree := BuildRandomTree(100, 1)
+	keys, sizes := tree.Columns()
+	view, err := ViewSorted(keys, sizes)
+	assert.Equal(t, err, nil, "Could not view sorted slices")
+	assert.Equal(t, view.Total(), tree.Total(), "Wrong total amount")
+	assert.Equal(t, view.Size(), tree.Size(), "Wrong number of keys")
+	for point := -1; point <= tree.Total(); point++ {
+		wantKey, wantOk := tree.Find(point)
+		key, ok := view.Find(point)
+		assert.Equal(t, [2]interface{}{key, ok}, [2]interface{}{wantKey, wantOk}, "Find differs from tree")
+	}
+	for key := -1; key <= 100; key++ {
+		wantSize, wantOffset, wantOk := tree.Get(key)
+		size, offset, ok := view.Get(key)
+		assert.Equal(t, [3]interface{}{size, offset, ok}, [3]interface{}{wantSize, wantOffset, wantOk}, "Get differs from tree")
+	}
+
+	for _, c := range []struct{ keys, sizes []int }{
+		{[]int{1, 2}, []int{1}},
+		{[]int{1, 2}, []int{1, 0}},
+		{[]int{2, 1}, []int{1, 1}},
+		{[]int{1, 1}, []int{1, 1}},
+		{[]int{1, 2}, []int{math.MaxInt, 1}},
+	} {
+		_, err := ViewSorted(c.keys, c.sizes)
+		assert.Equal(t, err != nil, true, "Accepted invalid slices")
+	}
+	{
+		empty, err := ViewSorted(nil, nil)
+		assert.Equal(t, err, nil, "Could not view empty slices")
+		_, ok := empty.Find(0)
+		assert.Equal(t, ok, false, "Found point in empty view")
+	}
+}
@@ -0,0 +1,20 @@
+package soseg
+
+import "log/slog"
+
+var _ slog.LogValuer = (*Tree)(nil)
+
+// LogValue implements slog.LogValuer, so that logging a tree emits
+// its Size, Total, Height and, unless empty, MinKey and MaxKey as a group.
+// Computing the height costs O(n).
+func (t *Tree) LogValue() slog.Value {
+	attrs := []slog.Attr{
+		slog.Int("Size", t.Size()),
+		slog.Int("Total", t.Total()),
+		slog.Int("Height", t.Height()),
+	}
+	if min, max, ok := t.KeySpan(); ok {
+		attrs = append(attrs, slog.Int("MinKey", min), slog.Int("MaxKey", max))
+	}
+	return slog.GroupValue(attrs...)
+}
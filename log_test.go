@@ -0,0 +1,32 @@
+package soseg
+
+import (
+	"bytes"
+	"github.com/magiconair/properties/assert"
+	"log/slog"
+	"testing"
+)
+
+func TestTree_LogValue(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{
+		ReplaceAttr: func(_ []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return a
+		},
+	}))
+
+	var tree Tree
+	logger.Info("empty", "tree", &tree)
+	tree.Put(3, 5)
+	tree.Put(1, 2)
+	tree.PutRange(10, 11, 1)
+	logger.Info("filled", "tree", &tree)
+
+	assert.Equal(t, buf.String(),
+		"level=INFO msg=empty tree.Size=0 tree.Total=0 tree.Height=0\n"+
+			"level=INFO msg=filled tree.Size=4 tree.Total=9 tree.Height=3 tree.MinKey=1 tree.MaxKey=11\n",
+		"Wrong log output")
+}
@@ -0,0 +1,156 @@
+package soseg
+
+import (
+	"math"
+	"math/bits"
+)
+
+// PutRange inserts all keys in [lo, hi] with the same positive weight,
+// replacing existing keys in the interval.
+// The keys are stored as a single leaf, so a dense run of keys costs O(log n)
+// to insert and one node of memory regardless of its length.
+// Lookups treat every key of the run like a key inserted with Put.
+// Changing or removing a single key splits the run around it.
+// Key ranges require the native key ordering.
+// It fails without changing the tree if the new total would overflow.
+func (t *Tree) PutRange(lo, hi, perKeyWeight int) error {
+	switch {
+	case t.less != nil:
+		return errorf(ErrUnsupported, "soseg: key ranges require the native key ordering")
+	case hi < lo:
+		return errorf(ErrOutOfRange, "soseg: empty key range [%d, %d]", lo, hi)
+	case perKeyWeight <= 0:
+		return errorf(ErrNonPositiveWeight, "soseg: non-positive size %d", perKeyWeight)
+	}
+	span := uint64(hi) - uint64(lo)
+	wHi, w := bits.Mul64(span+1, uint64(perKeyWeight))
+	if span >= math.MaxInt || wHi != 0 || w > math.MaxInt {
+		return errorf(ErrOverflow, "soseg: weight of key range [%d, %d] overflows", lo, hi)
+	}
+
+	var overlap []Node
+	if t.Root != nil {
+		overlap = t.Root.collect(t, lo, hi, overlap)
+	}
+	replaced := 0
+	for _, n := range overlap {
+		replaced += n.Value
+	}
+	if int(w) > math.MaxInt-(t.Total()-replaced) {
+		return errorf(ErrOverflow, "soseg: weight of key range [%d, %d] overflows", lo, hi)
+	}
+
+	if len(overlap) > 0 {
+		// Split runs crossing the bounds, so that every overlapping leaf
+		// lies completely inside the interval and can be unlinked
+		t.isolate(lo)
+		t.isolate(hi)
+		for _, n := range t.Root.collect(t, lo, hi, overlap[:0]) {
+			t.unlink(t.leaf(n.Key))
+		}
+		if t.Root != nil {
+			t.updateBounds()
+		}
+	}
+	t.insert(lo, int(span), int(w))
+	t.record(Op{Kind: OpPutRange, Key: lo, Last: hi, Size: perKeyWeight})
+	return nil
+}
+
+// CompactRuns collapses maximal runs of consecutive keys with the same positive weight
+// into single leaves like PutRange and rebuilds the tree in O(n) if any changed.
+// It returns the number of leaves eliminated. The entries are left unchanged,
+// so every key keeps its weight and range. Trees with a custom key ordering
+// are left alone.
+func (t *Tree) CompactRuns() (eliminated int) {
+	if t.less != nil {
+		return 0
+	}
+	var leaves []Node
+	t.leaves(func(n *Node) bool {
+		if k := len(leaves) - 1; k >= 0 {
+			prev := &leaves[k]
+			if per := prev.per(); per > 0 && per == n.per() && prev.last()+1 == n.Key {
+				prev.span += n.span + 1
+				prev.Value += n.Value
+				eliminated++
+				return true
+			}
+		}
+		leaves = append(leaves, Node{Key: n.Key, Value: n.Value, span: n.span})
+		return true
+	})
+	if eliminated > 0 {
+		t.buildLeaves(leaves)
+	}
+	return eliminated
+}
+
+// isolate returns the leaf with the specified key or nil like leaf,
+// splitting a key range around it first so that the leaf only covers that key.
+func (t *Tree) isolate(key int) *Node {
+	n := t.leaf(key)
+	if n == nil || n.span == 0 {
+		return n
+	}
+
+	// Shrink n to the keys on one side of key, then insert the others.
+	// Inserting may rebuild the tree, so n is not used afterwards.
+	lo, hi, per := n.Key, n.last(), n.per()
+	if key == lo {
+		n.Key, n.span = lo+1, n.span-1
+		n.addBranch(-per)
+		t.size--
+		t.insert(key, 0, per)
+	} else {
+		n.span = key - 1 - lo
+		n.addBranch((n.span+1)*per - n.Value)
+		t.size -= hi - key + 1
+		t.insert(key, 0, per)
+		if key < hi {
+			t.insert(key+1, hi-key-1, (hi-key)*per)
+		}
+	}
+	return t.leaf(key)
+}
+
+// covers reports whether key is one of the keys of the leaf.
+func (n *Node) covers(key int) bool {
+	return key == n.Key || n.span > 0 && key > n.Key && key <= n.last()
+}
+
+// last returns the largest key covered by the leaf.
+func (n *Node) last() int {
+	return n.Key + n.span
+}
+
+// per returns the weight of each key covered by the leaf.
+func (n *Node) per() int {
+	if n.span == 0 {
+		return n.Value
+	}
+	return n.Value / (n.span + 1)
+}
+
+// keyAt returns the key of the leaf whose range contains rel,
+// a point relative to the offset of the leaf.
+func (n *Node) keyAt(rel int) int {
+	if n.span == 0 {
+		return n.Key
+	}
+	return n.Key + rel/n.per()
+}
+
+// each calls fn for each key and its weight in key order until fn returns false,
+// expanding key ranges into their individual keys.
+func (t *Tree) each(fn func(key, size int) bool) {
+	t.leaves(func(n *Node) bool {
+		size := n.per()
+		for i := 0; i <= n.span; i++ {
+			if !fn(n.Key+i, size) {
+				return false
+			}
+		}
+		return true
+	})
+}
@@ -0,0 +1,217 @@
+package soseg
+
+import (
+	"github.com/magiconair/properties/assert"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestTree_PutRange(t *testing.T) {
+	var tree Tree
+	tree.Put(0, 10)
+	assert.Equal(t, tree.PutRange(10, 19, 3), nil, "Could not put range")
+	tree.Put(30, 5)
+
+	assert.Equal(t, tree.Size(), 12, "Wrong size")
+	assert.Equal(t, tree.Total(), 45, "Wrong total")
+	assert.Equal(t, tree.Height(), 3, "Range should be a single leaf")
+	{
+		max, _ := tree.Max()
+		assert.Equal(t, max, 30, "Wrong max")
+	}
+
+	// Interior keys behave like single keys
+	for key := 10; key <= 19; key++ {
+		size, offset, ok := tree.Get(key)
+		assert.Equal(t, ok, true, "Interior key not found")
+		assert.Equal(t, size, 3, "Wrong interior size")
+		assert.Equal(t, offset, 10+(key-10)*3, "Wrong interior offset")
+		assert.Equal(t, tree.Contains(key), true, "Interior key not contained")
+	}
+	for _, key := range []int{1, 9, 20, 29} {
+		_, _, ok := tree.Get(key)
+		assert.Equal(t, ok, false, "Found key outside of range")
+	}
+	for point := 10; point < 40; point++ {
+		key, ok := tree.Find(point)
+		assert.Equal(t, ok, true, "Could not find point in range")
+		assert.Equal(t, key, 10+(point-10)/3, "Wrong key for point in range")
+	}
+	{
+		e, _ := tree.FindEntry(14)
+		assert.Equal(t, e, Entry{Key: 11, Size: 3, Offset: 13}, "Wrong entry in range")
+	}
+	assert.Equal(t, len(tree.Entries()), 12, "Range not expanded in entries")
+
+	// Sampling is uniform within the range
+	r := rand.New(rand.NewSource(1))
+	counts := make(map[int]int)
+	for i := 0; i < 100000; i++ {
+		key, _ := tree.Sample(r)
+		counts[key]++
+	}
+	want := map[int]float64{0: 10.0 / 45, 30: 5.0 / 45}
+	for key := 10; key <= 19; key++ {
+		want[key] = 3.0 / 45
+	}
+	assertProportions(t, counts, want, 0.01)
+
+	// Errors
+	assert.Equal(t, tree.PutRange(5, 4, 1) != nil, true, "Accepted empty range")
+	assert.Equal(t, tree.PutRange(40, 50, 0) != nil, true, "Accepted non-positive weight")
+	assert.Equal(t, tree.PutRange(math.MinInt, math.MaxInt, 1) != nil, true, "Accepted overflowing range")
+	assert.Equal(t, NewWithLess(func(a, b int) bool { return a > b }).PutRange(0, 1, 1) != nil, true, "Accepted custom order")
+	assert.Equal(t, tree.Total(), 45, "Failed PutRange changed tree")
+}
+
+func TestTree_PutRange_Split(t *testing.T) {
+	var tree Tree
+	tree.PutRange(0, 9, 2)
+	expect := func(msg string) {
+		t.Helper()
+		var flat Tree
+		for _, e := range tree.Entries() {
+			flat.Put(e.Key, e.Size)
+		}
+		assert.Equal(t, tree.Boundaries(), flat.Boundaries(), msg)
+		for point := 0; point < tree.Total(); point++ {
+			a, _ := tree.Find(point)
+			b, _ := flat.Find(point)
+			assert.Equal(t, a, b, msg)
+		}
+	}
+
+	old, existed := tree.PutReturning(4, 7)
+	assert.Equal(t, old, 2, "Wrong old interior size")
+	assert.Equal(t, existed, true, "Interior key did not exist")
+	expect("Wrong ranges after update in range")
+
+	assert.Equal(t, tree.Remove(0), true, "Could not remove first key of range")
+	assert.Equal(t, tree.Remove(9), true, "Could not remove last key of range")
+	assert.Equal(t, tree.Remove(6), true, "Could not remove interior key")
+	assert.Equal(t, tree.Remove(6), false, "Removed key twice")
+	expect("Wrong ranges after removal in range")
+	{
+		min, _ := tree.Min()
+		max, _ := tree.Max()
+		assert.Equal(t, [2]int{min, max}, [2]int{1, 8}, "Wrong bounds after removal")
+	}
+	{
+		size, _ := tree.AdjustWeight(2, 1)
+		assert.Equal(t, size, 3, "Wrong adjusted size")
+	}
+	assert.Equal(t, tree.Size(), 7, "Wrong size after splits")
+	expect("Wrong ranges after adjustment")
+
+	// Overlapping ranges replace existing keys
+	tree.Put(20, 1)
+	tree.PutRange(3, 20, 1)
+	assert.Equal(t, tree.Size(), 20, "Wrong size after overlapping range")
+	assert.Equal(t, tree.Total(), 2+3+18, "Wrong total after overlapping range")
+	expect("Wrong ranges after overlapping range")
+
+	tree.SetMaxHeightFactor(1.01)
+	for key := 3; key <= 20; key += 2 {
+		tree.Put(key, key)
+	}
+	expect("Wrong ranges after rebuilds")
+
+	var within []int
+	for _, e := range tree.Entries() {
+		if e.Key >= 4 && e.Key <= 10 {
+			within = append(within, e.Size)
+		}
+	}
+	_, sizes := tree.Subtree(4, 10).Columns()
+	assert.Equal(t, sizes, within, "Wrong clipped subtree")
+	tree.RemoveBatch([]int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10})
+	expect("Wrong ranges after batch removal")
+	assert.Equal(t, tree.Size(), 10, "Wrong size after batch removal")
+}
+
+func TestTree_PutRange_Random(t *testing.T) {
+	var tree Tree
+	tree.SetMaxHeightFactor(2)
+	model := make(map[int]int)
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 2000; i++ {
+		key := r.Intn(200)
+		switch r.Intn(4) {
+		case 0:
+			hi := key + r.Intn(20)
+			size := 1 + r.Intn(5)
+			tree.PutRange(key, hi, size)
+			for k := key; k <= hi; k++ {
+				model[k] = size
+			}
+		case 1:
+			size := 1 + r.Intn(5)
+			tree.Put(key, size)
+			model[key] = size
+		case 2:
+			_, ok := model[key]
+			assert.Equal(t, tree.Remove(key), ok, "Wrong removal result")
+			delete(model, key)
+		case 3:
+			tree.RemoveBatch([]int{key, key + 1, key + 3})
+			delete(model, key)
+			delete(model, key+1)
+			delete(model, key+3)
+		}
+	}
+
+	var flat Tree
+	for key, size := range model {
+		flat.Put(key, size)
+	}
+	assert.Equal(t, tree.Entries(), flat.Entries(), "Entries differ from model")
+	{
+		min, _ := tree.Min()
+		max, _ := tree.Max()
+		flatMin, _ := flat.Min()
+		flatMax, _ := flat.Max()
+		assert.Equal(t, [2]int{min, max}, [2]int{flatMin, flatMax}, "Bounds differ from model")
+	}
+	for point := 0; point < tree.Total(); point++ {
+		a, _ := tree.Find(point)
+		b, _ := flat.Find(point)
+		assert.Equal(t, a, b, "Find differs from model")
+	}
+}
+
+func TestTree_CompactRuns(t *testing.T) {
+	var tree Tree
+	for key := 0; key < 100; key++ {
+		tree.Put(key, 3)
+	}
+	assert.Equal(t, tree.CompactRuns(), 99, "Wrong number of eliminated leaves")
+	assert.Equal(t, tree.Height(), 1, "Uniform tree should be a single leaf")
+	assert.Equal(t, tree.Size(), 100, "Wrong size")
+	assert.Equal(t, tree.Total(), 300, "Wrong total")
+	for key := 0; key < 100; key++ {
+		size, offset, ok := tree.Get(key)
+		assert.Equal(t, ok, true, "Key lost by compaction")
+		assert.Equal(t, size, 3, "Wrong size after compaction")
+		assert.Equal(t, offset, 3*key, "Wrong offset after compaction")
+	}
+	assert.Equal(t, tree.CompactRuns(), 0, "Compacted twice")
+
+	// Runs end at gaps, weight changes and soft-removed keys
+	tree.Remove(10)
+	tree.Put(20, 4)
+	tree.SoftRemove(30)
+	tree.SoftRemove(31)
+	tree.PutRange(40, 49, 3)
+	want := tree.Entries()
+	assert.Equal(t, tree.CompactRuns(), 2, "Wrong number of eliminated leaves")
+	assert.Equal(t, tree.Entries(), want, "Compaction changed entries")
+	leaves := 0
+	tree.leaves(func(*Node) bool {
+		leaves++
+		return true
+	})
+	assert.Equal(t, leaves, 7, "Wrong number of leaves")
+
+	assert.Equal(t, NewWithLess(func(a, b int) bool { return a > b }).CompactRuns(), 0, "Compacted custom order")
+}
@@ -0,0 +1,74 @@
+package soseg
+
+import (
+	"math"
+	"math/rand"
+)
+
+// Reservoir maintains a weighted sample without replacement of fixed size
+// over a stream of keys using the A-Res algorithm.
+// Each offered key draws the priority u^(1/weight) for a uniform u,
+// and the reservoir keeps the keys with the largest priorities.
+// The kept keys are stored in a Tree ordered by priority,
+// so that the key to evict is its Min.
+type Reservoir struct {
+	k        int
+	r        *rand.Rand
+	tree     *Tree
+	priority map[int]float64
+}
+
+// NewReservoir returns an empty reservoir keeping up to k keys drawn with r.
+func NewReservoir(k int, r *rand.Rand) *Reservoir {
+	res := &Reservoir{k: k, r: r, priority: make(map[int]float64, k)}
+	res.tree = NewWithLess(func(a, b int) bool {
+		pa, pb := res.priority[a], res.priority[b]
+		return pa < pb || pa == pb && a < b
+	})
+	return res
+}
+
+// Offer adds a key of the stream with a positive weight in O(log k).
+// Keys with non-positive weights can never be sampled and are ignored.
+// Offering a key again replaces its previous offer.
+func (res *Reservoir) Offer(key, weight int) {
+	if weight <= 0 || res.k <= 0 {
+		return
+	}
+	if _, ok := res.priority[key]; ok {
+		res.tree.Remove(key)
+		delete(res.priority, key)
+	}
+
+	// Compare log(u)/weight instead of u^(1/weight) to avoid underflow
+	p := math.Log(1-res.r.Float64()) / float64(weight)
+	if res.tree.Size() >= res.k {
+		min, _ := res.tree.Min()
+		if p <= res.priority[min] {
+			return
+		}
+		res.tree.Remove(min)
+		delete(res.priority, min)
+	}
+	res.priority[key] = p
+	res.tree.Put(key, weight)
+}
+
+// Sample returns the kept keys in descending priority order,
+// which is the order of a weighted draw without replacement.
+func (res *Reservoir) Sample() []int {
+	keys := make([]int, 0, res.tree.Size())
+	res.tree.leaves(func(n *Node) bool {
+		keys = append(keys, n.Key)
+		return true
+	})
+	for i, j := 0, len(keys)-1; i < j; i, j = i+1, j-1 {
+		keys[i], keys[j] = keys[j], keys[i]
+	}
+	return keys
+}
+
+// Size returns the number of kept keys, at most k.
+func (res *Reservoir) Size() int {
+	return res.tree.Size()
+}
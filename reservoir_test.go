@@ -0,0 +1,60 @@
+package soseg
+
+import (
+	"github.com/magiconair/properties/assert"
+	"math/rand"
+	"testing"
+)
+
+func TestReservoir(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	weights := map[int]int{0: 1, 1: 2, 2: 3, 3: 4}
+	const total = 10
+
+	// Inclusion probabilities of a weighted draw of two keys without replacement
+	want := make(map[int]float64)
+	for i, wi := range weights {
+		p := float64(wi) / total
+		for j, wj := range weights {
+			if j != i {
+				p += float64(wj) / total * float64(wi) / float64(total-wj)
+			}
+		}
+		want[i] = p / 2
+	}
+
+	counts := make(map[int]int)
+	for trial := 0; trial < 50000; trial++ {
+		res := NewReservoir(2, r)
+		for key := 0; key < 4; key++ {
+			res.Offer(key, weights[key])
+		}
+		sample := res.Sample()
+		assert.Equal(t, len(sample), 2, "Wrong reservoir size")
+		for _, key := range sample {
+			counts[key]++
+		}
+	}
+	assertProportions(t, counts, want, 0.01)
+
+	// A single key is a weighted sample
+	counts = make(map[int]int)
+	for trial := 0; trial < 50000; trial++ {
+		res := NewReservoir(1, r)
+		for key := 0; key < 4; key++ {
+			res.Offer(key, weights[key])
+		}
+		counts[res.Sample()[0]]++
+	}
+	assertProportions(t, counts, map[int]float64{0: 0.1, 1: 0.2, 2: 0.3, 3: 0.4}, 0.01)
+
+	res := NewReservoir(3, r)
+	for key := 0; key < 1000; key++ {
+		res.Offer(key, 1+key%7)
+		res.Offer(key, 0)
+	}
+	assert.Equal(t, res.Size(), 3, "Reservoir exceeds k")
+	res.Offer(5000, 1)
+	res.Offer(5000, 1)
+	assert.Equal(t, res.Size(), 3, "Repeated offer kept twice")
+}
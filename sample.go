@@ -0,0 +1,263 @@
+package soseg
+
+import (
+	crand "crypto/rand"
+	"math"
+	"math/big"
+	"math/bits"
+	"math/rand"
+)
+
+// Sample returns a random key with a probability proportional to its weight.
+func (t *Tree) Sample(r *rand.Rand) (key int, ok bool) {
+	total := t.Total()
+	if total <= 0 {
+		return 0, false
+	}
+	return t.Find(r.Intn(total))
+}
+
+// Probability returns the probability of Sample returning key, weight/Total().
+// It returns ok=false if the key is absent or the tree has no weight.
+func (t *Tree) Probability(key int) (p float64, ok bool) {
+	size, _, ok := t.Get(key)
+	total := t.Total()
+	if !ok || total <= 0 {
+		return 0, false
+	}
+	return float64(size) / float64(total), true
+}
+
+// SampleExcluding is like Sample but never returns excludeKey.
+// The remaining keys keep their relative proportions.
+// It returns ok=false if no other key is left to sample.
+func (t *Tree) SampleExcluding(r *rand.Rand, excludeKey int) (key int, ok bool) {
+	size, offset, ok := t.Get(excludeKey)
+	if !ok {
+		return t.Sample(r)
+	}
+	remaining := t.Total() - size
+	if remaining <= 0 {
+		return 0, false
+	}
+
+	// Skip over the excluded range
+	point := r.Intn(remaining)
+	if point >= offset {
+		point += size
+	}
+	return t.Find(point)
+}
+
+// SampleSecure is like Sample but draws from crypto/rand.
+// The point is drawn uniformly from [0, Total()) by rejection sampling,
+// so that there is no modulo bias.
+func (t *Tree) SampleSecure() (key int, err error) {
+	total := t.Total()
+	if total <= 0 {
+		return 0, ErrEmpty
+	}
+	point, err := crand.Int(crand.Reader, big.NewInt(int64(total)))
+	if err != nil {
+		return 0, err
+	}
+	key, _ = t.Find(int(point.Int64()))
+	return key, nil
+}
+
+// SampleAcross samples a key across several trees as if they were merged,
+// first picking a tree proportional to its Total() and then a key within it.
+// It returns ok=false if all trees are empty or their combined total overflows.
+func SampleAcross(r *rand.Rand, trees ...*Tree) (treeIndex, key int, ok bool) {
+	var total int
+	for _, t := range trees {
+		if total > math.MaxInt-t.Total() {
+			return 0, 0, false
+		}
+		total += t.Total()
+	}
+	if total <= 0 {
+		return 0, 0, false
+	}
+
+	// A single draw selects both the tree and the point within it
+	point := r.Intn(total)
+	for i, t := range trees {
+		if point < t.Total() {
+			key, ok = t.Find(point)
+			return i, key, ok
+		}
+		point -= t.Total()
+	}
+	return 0, 0, false
+}
+
+// SampleBatch returns n keys drawn independently with replacement,
+// each with a probability proportional to its weight.
+// Every draw is a separate descent, so the batch costs O(n log m) for m keys
+// without allocating beyond the result, which is empty for an empty tree.
+func (t *Tree) SampleBatch(r *rand.Rand, n int) []int {
+	total := t.Total()
+	if total <= 0 || n <= 0 {
+		return nil
+	}
+	keys := make([]int, n)
+	for i := range keys {
+		keys[i], _ = t.Find(r.Intn(total))
+	}
+	return keys
+}
+
+// EvenGrid returns the keys whose ranges contain the n evenly spaced points
+// (i+0.5)*Total()/n for i in [0, n), rounded down, for systematic sampling.
+// The keys are found in a single pass over all keys in O(m + n).
+func (t *Tree) EvenGrid(n int) []int {
+	total := t.Total()
+	if total <= 0 || n <= 0 {
+		return nil
+	}
+	keys := make([]int, 0, n)
+	point := func(i int) int {
+		hi, lo := bits.Mul64(uint64(2*i+1), uint64(total))
+		q, _ := bits.Div64(hi, lo, uint64(2*n))
+		return int(q)
+	}
+	next, offset := point(0), 0
+	t.each(func(key, size int) bool {
+		offset += size
+		for next < offset {
+			keys = append(keys, key)
+			if len(keys) == n {
+				return false
+			}
+			next = point(len(keys))
+		}
+		return true
+	})
+	return keys
+}
+
+// InverseCDFTable returns a lookup table of length resolution whose entry i is the key
+// whose range contains the point floor(i*Total()/resolution), in O(m + resolution).
+// Indexing the table with a uniform index in [0, resolution) approximates a weighted sample
+// in O(1): the probability of each key differs from its exact probability
+// by less than 1/resolution, so keys lighter than Total()/resolution may be missing.
+func (t *Tree) InverseCDFTable(resolution int) []int {
+	total := t.Total()
+	if total <= 0 || resolution <= 0 {
+		return nil
+	}
+	table := make([]int, 0, resolution)
+	point := func(i int) int {
+		hi, lo := bits.Mul64(uint64(i), uint64(total))
+		q, _ := bits.Div64(hi, lo, uint64(resolution))
+		return int(q)
+	}
+	next, offset := 0, 0
+	t.each(func(key, size int) bool {
+		offset += size
+		for next < offset {
+			table = append(table, key)
+			if len(table) == resolution {
+				return false
+			}
+			next = point(len(table))
+		}
+		return true
+	})
+	return table
+}
+
+// SampleDistinct performs draws weighted samples and returns
+// the number of distinct keys seen, estimating the effective diversity.
+func (t *Tree) SampleDistinct(r *rand.Rand, draws int) int {
+	seen := make(map[int]struct{})
+	for i := 0; i < draws; i++ {
+		key, ok := t.Sample(r)
+		if !ok {
+			break
+		}
+		seen[key] = struct{}{}
+	}
+	return len(seen)
+}
+
+// Owner maps a uniformly distributed hash onto [0, Total())
+// and returns the key owning that point, so that each key owns a share
+// of the hash space proportional to its weight.
+//
+// Keys own adjacent arcs in key order. Changing the weight of one key
+// moves the boundaries of all arcs after it and rescales the mapping,
+// so unlike a consistent hash ring, owners of other arcs may change too.
+func (t *Tree) Owner(hash uint64) (key int, ok bool) {
+	total := t.Total()
+	if total <= 0 {
+		return 0, false
+	}
+	point, _ := bits.Mul64(hash, uint64(total))
+	return t.Find(int(point))
+}
+
+// SampleVanDerCorput returns the key owning the i-th point of the base 2
+// van der Corput sequence scaled onto [0, Total()), for i >= 0.
+// The first n points of the sequence are spread more evenly than n random draws,
+// so deterministic stratified samples cover the distribution with lower discrepancy.
+// The point is the fraction with the bits of i mirrored after the binary point, used like in Owner.
+func (t *Tree) SampleVanDerCorput(i int) (key int, ok bool) {
+	if i < 0 {
+		return 0, false
+	}
+	return t.Owner(bits.Reverse64(uint64(i)))
+}
+
+// SampleTemperature samples keys proportional to w^(1/temp).
+// temp=1 is equivalent to Sample, higher temperatures flatten the
+// distribution towards uniform and lower ones sharpen it towards the heaviest key,
+// which is always returned for temp <= 0.
+// The stored weights cannot be reweighted cheaply,
+// so every call builds a temporary distribution in O(n).
+func (t *Tree) SampleTemperature(r *rand.Rand, temp float64) (key int, ok bool) {
+	if t.Total() <= 0 {
+		return 0, false
+	}
+	keys, sizes := t.Columns()
+
+	// Work with logarithms relative to the heaviest key to avoid overflow
+	heaviest := 0
+	for i, size := range sizes {
+		if size > sizes[heaviest] {
+			heaviest = i
+		}
+	}
+	if temp <= 0 {
+		return keys[heaviest], true
+	}
+	logMax := math.Log(float64(sizes[heaviest]))
+	cdf := make([]float64, len(sizes))
+	var sum float64
+	for i, size := range sizes {
+		sum += math.Exp((math.Log(float64(size)) - logMax) / temp)
+		cdf[i] = sum
+	}
+
+	point := r.Float64() * sum
+	for i, c := range cdf {
+		if point < c {
+			return keys[i], true
+		}
+	}
+	return keys[len(keys)-1], true
+}
+
+// SampleSub is like Sample but also returns the position of the drawn point
+// within the range of the key, uniform in [0, size), and the size of the key.
+// Both come from the same draw, so recursing into a sub-sampler needs no second one.
+func (t *Tree) SampleSub(r *rand.Rand) (key, subPoint, size int, ok bool) {
+	total := t.Total()
+	if total <= 0 {
+		return 0, 0, 0, false
+	}
+	point := r.Intn(total)
+	e, ok := t.FindEntry(point)
+	return e.Key, point - e.Offset, e.Size, ok
+}
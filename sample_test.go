@@ -0,0 +1,389 @@
+package soseg
+
+import (
+	"github.com/magiconair/properties/assert"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// assertProportions checks that the observed counts per key
+// are within tolerance of the expected fractions of all draws.
+func assertProportions(t *testing.T, counts map[int]int, want map[int]float64, tolerance float64) {
+	t.Helper()
+	draws := 0
+	for _, c := range counts {
+		draws += c
+	}
+	for key, c := range counts {
+		if _, ok := want[key]; !ok {
+			t.Fatalf("Sampled unexpected key %d", key)
+		}
+		got := float64(c) / float64(draws)
+		if math.Abs(got-want[key]) > tolerance {
+			t.Fatalf("Key %d sampled with frequency %f, want %f", key, got, want[key])
+		}
+	}
+}
+
+func TestTree_Sample(t *testing.T) {
+	var tree Tree
+	r := rand.New(rand.NewSource(1))
+	{
+		_, ok := tree.Sample(r)
+		assert.Equal(t, ok, false, "Sampled from empty tree")
+	}
+
+	tree.Put(0, 1)
+	tree.Put(1, 2)
+	tree.Put(2, 3)
+	tree.Put(3, 4)
+
+	counts := make(map[int]int)
+	for i := 0; i < 100000; i++ {
+		key, ok := tree.Sample(r)
+		assert.Equal(t, ok, true, "Could not sample from non-empty tree")
+		counts[key]++
+	}
+	assertProportions(t, counts, map[int]float64{0: 0.1, 1: 0.2, 2: 0.3, 3: 0.4}, 0.01)
+}
+
+func TestTree_Probability(t *testing.T) {
+	var tree Tree
+	{
+		_, ok := tree.Probability(0)
+		assert.Equal(t, ok, false, "Probability in empty tree")
+	}
+	tree.Put(0, 1)
+	tree.Put(1, 3)
+	tree.Put(2, 4)
+	for key, want := range map[int]float64{0: 0.125, 1: 0.375, 2: 0.5} {
+		p, ok := tree.Probability(key)
+		assert.Equal(t, ok, true, "No probability for existing key")
+		assert.Equal(t, p, want, "Wrong probability")
+	}
+	{
+		_, ok := tree.Probability(3)
+		assert.Equal(t, ok, false, "Probability for absent key")
+	}
+	tree.SoftRemove(0)
+	tree.SoftRemove(1)
+	tree.SoftRemove(2)
+	{
+		_, ok := tree.Probability(0)
+		assert.Equal(t, ok, false, "Probability in tree without weight")
+	}
+}
+
+func TestTree_SampleExcluding(t *testing.T) {
+	var tree Tree
+	tree.Put(0, 1)
+	tree.Put(1, 2)
+	tree.Put(2, 3)
+	tree.Put(3, 4)
+
+	r := rand.New(rand.NewSource(1))
+	counts := make(map[int]int)
+	for i := 0; i < 100000; i++ {
+		key, ok := tree.SampleExcluding(r, 2)
+		assert.Equal(t, ok, true, "Could not sample from non-empty tree")
+		counts[key]++
+	}
+	assert.Equal(t, counts[2], 0, "Sampled excluded key")
+	assertProportions(t, counts, map[int]float64{0: 1.0 / 7, 1: 2.0 / 7, 3: 4.0 / 7}, 0.01)
+
+	{
+		var single Tree
+		single.Put(5, 3)
+		_, ok := single.SampleExcluding(r, 5)
+		assert.Equal(t, ok, false, "Sampled from tree with only the excluded key")
+	}
+}
+
+func TestTree_SampleSecure(t *testing.T) {
+	var tree Tree
+	{
+		_, err := tree.SampleSecure()
+		assert.Equal(t, err != nil, true, "Sampled from empty tree")
+	}
+
+	tree.Put(2, 1)
+	tree.Put(5, 3)
+	tree.Put(9, 4)
+
+	counts := make(map[int]int)
+	for i := 0; i < 10000; i++ {
+		key, err := tree.SampleSecure()
+		assert.Equal(t, err, nil, "Could not sample from non-empty tree")
+		counts[key]++
+	}
+	assertProportions(t, counts, map[int]float64{2: 0.125, 5: 0.375, 9: 0.5}, 0.03)
+}
+
+func TestSampleAcross(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	var a, b, empty Tree
+	{
+		_, _, ok := SampleAcross(r, &a, &empty)
+		assert.Equal(t, ok, false, "Sampled from empty trees")
+	}
+
+	a.Put(0, 1)
+	a.Put(1, 2)
+	b.Put(0, 3)
+	b.Put(5, 4)
+
+	counts := make(map[int]int)
+	for i := 0; i < 100000; i++ {
+		index, key, ok := SampleAcross(r, &a, &empty, &b)
+		assert.Equal(t, ok, true, "Could not sample from non-empty trees")
+		counts[index*10+key]++
+	}
+	assertProportions(t, counts, map[int]float64{0: 0.1, 1: 0.2, 20: 0.3, 25: 0.4}, 0.01)
+
+	// Combined totals beyond math.MaxInt cannot be sampled uniformly
+	{
+		var big Tree
+		big.Put(0, math.MaxInt-1)
+		_, _, ok := SampleAcross(r, &a, &big)
+		assert.Equal(t, ok, false, "Sampled from overflowing totals")
+		_, _, ok = SampleAcross(r, &big, &empty)
+		assert.Equal(t, ok, true, "Could not sample from a large tree")
+	}
+}
+
+func TestTree_SampleBatch(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	var tree Tree
+	assert.Equal(t, len(tree.SampleBatch(r, 10)), 0, "Sampled batch from empty tree")
+
+	tree.Put(0, 1)
+	tree.Put(1, 2)
+	tree.Put(2, 3)
+	tree.Put(3, 4)
+	keys := tree.SampleBatch(r, 100000)
+	assert.Equal(t, len(keys), 100000, "Wrong batch size")
+	counts := make(map[int]int)
+	for _, key := range keys {
+		counts[key]++
+	}
+	assertProportions(t, counts, map[int]float64{0: 0.1, 1: 0.2, 2: 0.3, 3: 0.4}, 0.01)
+}
+
+func TestTree_EvenGrid(t *testing.T) {
+	var tree Tree
+	assert.Equal(t, len(tree.EvenGrid(4)), 0, "Grid over empty tree")
+	tree.Put(0, 1)
+	tree.Put(1, 2)
+	tree.Put(2, 3)
+	tree.Put(3, 4)
+	// Points 1, 3, 5, 7 and 9
+	assert.Equal(t, tree.EvenGrid(5), []int{1, 2, 2, 3, 3}, "Wrong grid")
+
+	tree = *BuildRandomTree(100, 1)
+	for _, n := range []int{1, 7, 100, 1000} {
+		grid := tree.EvenGrid(n)
+		assert.Equal(t, len(grid), n, "Wrong grid size")
+		for i, key := range grid {
+			want, _ := tree.Find(int((float64(i) + 0.5) * float64(tree.Total()) / float64(n)))
+			assert.Equal(t, key, want, "Grid key differs from Find")
+			if i > 0 && key < grid[i-1] {
+				t.Fatalf("Grid keys decrease at %d", i)
+			}
+		}
+	}
+}
+
+func TestTree_InverseCDFTable(t *testing.T) {
+	var tree Tree
+	assert.Equal(t, len(tree.InverseCDFTable(4)), 0, "Table over empty tree")
+	tree.Put(0, 1)
+	tree.Put(1, 2)
+	tree.Put(2, 3)
+	tree.Put(3, 4)
+	// Points 0, 2, 4, 6 and 8
+	assert.Equal(t, tree.InverseCDFTable(5), []int{0, 1, 2, 3, 3}, "Wrong table")
+
+	tree = *BuildRandomTree(100, 1)
+	total := tree.Total()
+	for _, resolution := range []int{1, 7, total, 4 * total} {
+		table := tree.InverseCDFTable(resolution)
+		assert.Equal(t, len(table), resolution, "Wrong table size")
+		for i, key := range table {
+			want, _ := tree.Find(i * total / resolution)
+			assert.Equal(t, key, want, "Table key differs from Find")
+		}
+	}
+}
+
+func TestTree_SampleDistinct(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	var tree Tree
+	assert.Equal(t, tree.SampleDistinct(r, 100), 0, "Distinct keys in empty tree")
+
+	tree.Put(0, 1000000)
+	for key := 1; key < 100; key++ {
+		tree.Put(key, 1)
+	}
+	total := tree.Total()
+	distinct := tree.SampleDistinct(r, 1000)
+	if distinct < 1 || distinct > 5 {
+		t.Fatalf("Skewed tree yields %d distinct keys", distinct)
+	}
+	assert.Equal(t, tree.Total(), total, "Tree changed by sampling")
+
+	uniform := BuildRandomTree(10, 1)
+	assert.Equal(t, uniform.SampleDistinct(r, 10000), 10, "Missed keys of small tree")
+}
+
+func TestTree_Owner(t *testing.T) {
+	var tree Tree
+	{
+		_, ok := tree.Owner(0)
+		assert.Equal(t, ok, false, "Owner in empty tree")
+	}
+
+	tree.Put(0, 1)
+	tree.Put(1, 2)
+	tree.Put(2, 3)
+	tree.Put(3, 4)
+
+	{
+		key, _ := tree.Owner(0)
+		assert.Equal(t, key, 0, "Wrong owner of lowest hash")
+		key, _ = tree.Owner(^uint64(0))
+		assert.Equal(t, key, 3, "Wrong owner of highest hash")
+	}
+
+	r := rand.New(rand.NewSource(1))
+	counts := make(map[int]int)
+	for i := 0; i < 100000; i++ {
+		key, ok := tree.Owner(r.Uint64())
+		assert.Equal(t, ok, true, "No owner in non-empty tree")
+		counts[key]++
+	}
+	assertProportions(t, counts, map[int]float64{0: 0.1, 1: 0.2, 2: 0.3, 3: 0.4}, 0.01)
+}
+
+func TestTree_SampleVanDerCorput(t *testing.T) {
+	var tree Tree
+	{
+		_, ok := tree.SampleVanDerCorput(1)
+		assert.Equal(t, ok, false, "Sample from empty tree")
+	}
+
+	tree.Put(0, 1)
+	tree.Put(1, 1)
+	tree.Put(2, 2)
+	// Points 0, 2, 1 and 3
+	for i, want := range []int{0, 2, 1, 2} {
+		key, ok := tree.SampleVanDerCorput(i)
+		assert.Equal(t, ok, true, "No sample from non-empty tree")
+		assert.Equal(t, key, want, "Wrong sample")
+	}
+	{
+		_, ok := tree.SampleVanDerCorput(-1)
+		assert.Equal(t, ok, false, "Sample for negative index")
+	}
+
+	tree = *BuildRandomTree(100, 1)
+	const n = 1000
+	// discrepancy returns the largest deviation of the cumulative sample counts
+	// from their expectation over all key boundaries
+	discrepancy := func(sample func(i int) int) float64 {
+		counts := make(map[int]int)
+		for i := 0; i < n; i++ {
+			counts[sample(i)]++
+		}
+		worst, seen, weight := 0.0, 0, 0
+		tree.each(func(key, size int) bool {
+			seen += counts[key]
+			weight += size
+			worst = math.Max(worst, math.Abs(float64(seen)-n*float64(weight)/float64(tree.Total())))
+			return true
+		})
+		return worst
+	}
+	r := rand.New(rand.NewSource(1))
+	quasi := discrepancy(func(i int) int {
+		key, _ := tree.SampleVanDerCorput(i)
+		return key
+	})
+	random := discrepancy(func(int) int {
+		key, _ := tree.Sample(r)
+		return key
+	})
+	if quasi > 10 || quasi >= random {
+		t.Fatalf("van der Corput discrepancy %.1f not below random discrepancy %.1f", quasi, random)
+	}
+}
+
+func TestTree_SampleTemperature(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	var tree Tree
+	{
+		_, ok := tree.SampleTemperature(r, 1)
+		assert.Equal(t, ok, false, "Sampled from empty tree")
+	}
+	{
+		var zero Tree
+		zero.Put(0, 1)
+		zero.Put(1, 1)
+		zero.SoftRemove(0)
+		zero.SoftRemove(1)
+		for _, temp := range []float64{0, 1, 2} {
+			_, ok := zero.SampleTemperature(r, temp)
+			assert.Equal(t, ok, false, "Sampled from zero weights")
+		}
+	}
+
+	tree.Put(0, 1)
+	tree.Put(1, 4)
+	tree.Put(2, 16)
+
+	frequencies := func(temp float64) map[int]int {
+		counts := make(map[int]int)
+		for i := 0; i < 100000; i++ {
+			key, _ := tree.SampleTemperature(r, temp)
+			counts[key]++
+		}
+		return counts
+	}
+
+	assertProportions(t, frequencies(1), map[int]float64{0: 1.0 / 21, 1: 4.0 / 21, 2: 16.0 / 21}, 0.01)
+	// w^(1/2) yields weights 1, 2 and 4
+	assertProportions(t, frequencies(2), map[int]float64{0: 1.0 / 7, 1: 2.0 / 7, 2: 4.0 / 7}, 0.01)
+	// w^2 yields weights 1, 16 and 256
+	assertProportions(t, frequencies(0.5), map[int]float64{0: 1.0 / 273, 1: 16.0 / 273, 2: 256.0 / 273}, 0.01)
+	assert.Equal(t, frequencies(0)[2], 100000, "Zero temperature did not pick the heaviest key")
+
+	hot := frequencies(100)
+	if hot[0] < 30000 {
+		t.Fatalf("High temperature did not flatten, lightest key drawn %d times", hot[0])
+	}
+}
+
+func TestTree_SampleSub(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	var tree Tree
+	{
+		_, _, _, ok := tree.SampleSub(r)
+		assert.Equal(t, ok, false, "Sampled from empty tree")
+	}
+
+	tree.Put(0, 2)
+	tree.Put(1, 4)
+
+	counts := make(map[int]int)
+	for i := 0; i < 60000; i++ {
+		key, subPoint, size, ok := tree.SampleSub(r)
+		assert.Equal(t, ok, true, "Could not sample from non-empty tree")
+		assert.Equal(t, size, 2+2*key, "Got wrong size")
+		counts[key*10+subPoint]++
+	}
+	// Every point of the total is equally likely
+	assertProportions(t, counts, map[int]float64{
+		0: 1.0 / 6, 1: 1.0 / 6,
+		10: 1.0 / 6, 11: 1.0 / 6, 12: 1.0 / 6, 13: 1.0 / 6,
+	}, 0.01)
+}
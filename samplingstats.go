@@ -0,0 +1,55 @@
+package soseg
+
+import "math/rand"
+
+// SamplingStats wraps a Tree and tracks the count, mean and variance
+// of the keys it samples, using Welford's online algorithm,
+// e.g. to validate the sampler at runtime.
+type SamplingStats struct {
+	Tree *Tree
+
+	count int
+	mean  float64
+	m2    float64
+}
+
+// NewSamplingStats returns SamplingStats sampling from t.
+func NewSamplingStats(t *Tree) *SamplingStats {
+	return &SamplingStats{Tree: t}
+}
+
+// Sample is like Tree.Sample and adds the sampled key to the statistics.
+func (s *SamplingStats) Sample(r *rand.Rand) (key int, ok bool) {
+	key, ok = s.Tree.Sample(r)
+	if ok {
+		s.count++
+		delta := float64(key) - s.mean
+		s.mean += delta / float64(s.count)
+		s.m2 += delta * (float64(key) - s.mean)
+	}
+	return key, ok
+}
+
+// Count returns the number of keys sampled since the last Reset.
+func (s *SamplingStats) Count() int {
+	return s.count
+}
+
+// Mean returns the mean of the sampled keys, or 0 before the first sample.
+func (s *SamplingStats) Mean() float64 {
+	return s.mean
+}
+
+// Variance returns the sample variance of the sampled keys,
+// or 0 before the second sample.
+func (s *SamplingStats) Variance() float64 {
+	if s.count < 2 {
+		return 0
+	}
+	return s.m2 / float64(s.count-1)
+}
+
+// Reset clears the statistics.
+func (s *SamplingStats) Reset() {
+	s.count, s.mean, s.m2 = 0, 0, 0
+}
@@ -0,0 +1,42 @@
+package soseg
+
+import (
+	"github.com/magiconair/properties/assert"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestSamplingStats(t *testing.T) {
+	var tree Tree
+	tree.Put(0, 1)
+	tree.Put(1, 2)
+	tree.Put(2, 3)
+	tree.Put(3, 4)
+	stats := NewSamplingStats(&tree)
+	assert.Equal(t, stats.Variance(), 0.0, "Variance without samples")
+
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 100000; i++ {
+		stats.Sample(r)
+	}
+	assert.Equal(t, stats.Count(), 100000, "Wrong sample count")
+
+	// Keys weighted 1..4 have mean 2 and variance 1
+	mean, ok := tree.WeightedMeanKey()
+	assert.Equal(t, ok, true, "No mean of non-empty tree")
+	assert.Equal(t, mean, 2.0, "Wrong weighted mean")
+	if math.Abs(stats.Mean()-mean) > 0.01 {
+		t.Fatalf("Sampled mean %f does not converge to %f", stats.Mean(), mean)
+	}
+	if math.Abs(stats.Variance()-1) > 0.02 {
+		t.Fatalf("Sampled variance %f does not converge to 1", stats.Variance())
+	}
+
+	stats.Reset()
+	assert.Equal(t, [2]float64{stats.Mean(), stats.Variance()}, [2]float64{}, "Statistics not reset")
+	{
+		_, ok := new(Tree).WeightedMeanKey()
+		assert.Equal(t, ok, false, "Mean of empty tree")
+	}
+}
@@ -0,0 +1,73 @@
+package soseg
+
+import "math"
+
+// SetRebuildAlpha makes Put and Remove keep the tree balanced
+// with localized rebuilds like a scapegoat tree.
+// Once a new leaf lies deeper than log(Size())/log(1/alpha),
+// the lowest ancestor with a child holding more than alpha of its leaves
+// is rebuilt into a balanced subtree, which amortizes to O(log n) per Put.
+// Remove rebuilds the whole tree once the size drops below alpha times
+// the size after the last full rebuild.
+// Alpha must lie in (0.5, 1), smaller values balance more eagerly.
+// Any other value, such as 0, disables the rebuilds.
+func (t *Tree) SetRebuildAlpha(alpha float64) {
+	if !(alpha > 0.5 && alpha < 1) {
+		alpha = 0
+	}
+	t.rebuildAlpha = alpha
+	t.maxSize = t.size
+}
+
+// scapegoat rebuilds the subtree of the lowest unbalanced ancestor of leaf
+// if leaf lies too deep and reports whether it did.
+func (t *Tree) scapegoat(leaf *Node, depth int) bool {
+	t.maxSize = max(t.maxSize, t.size)
+	if float64(depth) <= math.Log(float64(t.size))/-math.Log(t.rebuildAlpha) {
+		return false
+	}
+
+	size := 1
+	for x := leaf; x.Parent != nil; x = x.Parent {
+		parent := x.Parent
+		sibling := parent.Children[0]
+		if sibling == x {
+			sibling = parent.Children[1]
+		}
+		total := size + sibling.count()
+		if float64(size) > t.rebuildAlpha*float64(total) {
+			t.rebuildSubtree(parent)
+			return true
+		}
+		size = total
+	}
+	return false
+}
+
+// rebuildSubtree replaces the subtree below and including n with a balanced one,
+// reusing its nodes. The branch keys above stay valid since the keys are unchanged.
+func (t *Tree) rebuildSubtree(n *Node) {
+	var leaves []Node
+	n.leaves(func(l *Node) bool {
+		leaves = append(leaves, Node{Key: l.Key, Value: l.Value, span: l.span})
+		return true
+	})
+	parent := n.Parent
+	pivot := &t.Root
+	if parent != nil {
+		pivot = &parent.Children[0]
+		if parent.Children[1] == n {
+			pivot = &parent.Children[1]
+		}
+	}
+	n.retain(&t.free)
+	*pivot = t.buildNode(leaves, parent)
+}
+
+// count returns the number of leaves in the subtree.
+func (n *Node) count() int {
+	if n.Terminal {
+		return 1
+	}
+	return n.Children[0].count() + n.Children[1].count()
+}
@@ -0,0 +1,43 @@
+package soseg
+
+import (
+	"github.com/magiconair/properties/assert"
+	"math"
+	"testing"
+)
+
+func TestTree_SetRebuildAlpha(t *testing.T) {
+	const alpha = 0.7
+	var tree Tree
+	tree.SetRebuildAlpha(alpha)
+	bound := func() int {
+		return int(math.Log(float64(tree.Size()))/-math.Log(alpha)) + 2
+	}
+
+	// Ascending inserts degenerate into a chain without rebuilds
+	for key := 0; key < 10000; key++ {
+		tree.Put(key, key%5+1)
+		if key%500 == 499 && tree.Height() > bound() {
+			t.Fatalf("Height %d exceeds %d after %d ascending inserts", tree.Height(), bound(), key+1)
+		}
+	}
+	for key := 0; key < 10000; key++ {
+		_, offset, ok := tree.Get(key)
+		assert.Equal(t, ok, true, "Key lost by rebuilds")
+		assert.Equal(t, offset, key/5*15+[]int{0, 1, 3, 6, 10}[key%5], "Wrong offset after rebuilds")
+	}
+
+	for key := 0; key < 9000; key++ {
+		tree.Remove(key)
+	}
+	assert.Equal(t, tree.Height() <= bound(), true, "Height unbounded after removals")
+	assert.Equal(t, tree.Size(), 1000, "Wrong size after removals")
+
+	// Out of range alphas disable the rebuilds
+	var chain Tree
+	chain.SetRebuildAlpha(0.4)
+	for key := 0; key < 100; key++ {
+		chain.Put(key, 1)
+	}
+	assert.Equal(t, chain.Height(), 100, "Rebuilt with invalid alpha")
+}
@@ -0,0 +1,113 @@
+package soseg
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// SeqTree is a Tree that can be read and written concurrently.
+//
+// Readers never take a lock.
+// A classic seqlock, where readers retry after a concurrent write,
+// is not possible here: readers would chase node pointers while a writer
+// rewires them, which is a data race and can dereference half-built branches.
+// Instead, writers serialize on a mutex, apply the change to a private copy
+// and publish it atomically with a new sequence number.
+// Readers always see a complete version and never have to retry,
+// at the cost of an O(n) copy per write.
+type SeqTree struct {
+	mu  sync.Mutex
+	cur atomic.Pointer[seqVersion]
+}
+
+var _ Reader = (*SeqTree)(nil)
+
+type seqVersion struct {
+	seq  uint64
+	tree *Tree
+}
+
+// NewSeqTree returns an empty SeqTree.
+func NewSeqTree() *SeqTree {
+	s := new(SeqTree)
+	s.cur.Store(&seqVersion{tree: new(Tree)})
+	return s
+}
+
+func (s *SeqTree) load() *Tree {
+	return s.cur.Load().tree
+}
+
+// write applies fn to a copy of the current tree and publishes the result.
+func (s *SeqTree) write(fn func(t *Tree)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cur := s.cur.Load()
+	next := cur.tree.Clone()
+	fn(next)
+	s.cur.Store(&seqVersion{seq: cur.seq + 1, tree: next})
+}
+
+// Seq returns the number of writes published so far.
+func (s *SeqTree) Seq() uint64 {
+	return s.cur.Load().seq
+}
+
+// Apply runs fn on a private copy of the tree and publishes the result as a single write,
+// so a batch of changes costs one O(n) copy instead of one per change.
+// Readers see either none or all of the changes. fn must not retain the tree
+// or call methods of s.
+func (s *SeqTree) Apply(fn func(t *Tree)) {
+	s.write(fn)
+}
+
+// Put is the concurrent version of Tree.Put.
+// It copies the whole tree in O(n), use Apply to insert many keys at once.
+func (s *SeqTree) Put(key int, size int) (created bool) {
+	s.write(func(t *Tree) {
+		created = t.Put(key, size)
+	})
+	return
+}
+
+// Remove is the concurrent version of Tree.Remove.
+// It copies the whole tree in O(n), use Apply to remove many keys at once.
+func (s *SeqTree) Remove(key int) (ok bool) {
+	s.write(func(t *Tree) {
+		ok = t.Remove(key)
+	})
+	return
+}
+
+// Clear is the concurrent version of Tree.Clear.
+func (s *SeqTree) Clear() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cur := s.cur.Load()
+	s.cur.Store(&seqVersion{seq: cur.seq + 1, tree: new(Tree)})
+}
+
+// Get is the concurrent version of Tree.Get.
+func (s *SeqTree) Get(key int) (size int, offset int, ok bool) {
+	return s.load().Get(key)
+}
+
+// Find is the concurrent version of Tree.Find.
+func (s *SeqTree) Find(point int) (key int, ok bool) {
+	return s.load().Find(point)
+}
+
+// FindEntry is the concurrent version of Tree.FindEntry.
+func (s *SeqTree) FindEntry(point int) (Entry, bool) {
+	return s.load().FindEntry(point)
+}
+
+// Total is the concurrent version of Tree.Total.
+func (s *SeqTree) Total() int {
+	return s.load().Total()
+}
+
+// Size is the concurrent version of Tree.Size.
+func (s *SeqTree) Size() int {
+	return s.load().Size()
+}
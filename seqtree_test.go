@@ -0,0 +1,71 @@
+package soseg
+
+import (
+	"github.com/magiconair/properties/assert"
+	"sync"
+	"testing"
+)
+
+func TestSeqTree(t *testing.T) {
+	s := NewSeqTree()
+	for key := 0; key < 100; key++ {
+		s.Put(key, 1)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				// Every write keeps a weight of 1 per key
+				total := s.Total()
+				if key, ok := s.Find(total - 1); ok {
+					if size, _, ok := s.Get(key); ok && size != 1 {
+						t.Errorf("Got wrong value %d", size)
+					}
+				}
+			}
+		}()
+	}
+	for key := 100; key < 200; key++ {
+		s.Put(key, 1)
+		s.Remove(key - 100)
+	}
+	wg.Wait()
+
+	assert.Equal(t, s.Size(), 100, "Wrong number of nodes")
+	assert.Equal(t, s.Total(), 100, "Wrong total amount")
+	assert.Equal(t, s.Seq(), uint64(300), "Wrong number of writes")
+	{
+		_, offset, ok := s.Get(150)
+		assert.Equal(t, ok, true, "Not found but inserted")
+		assert.Equal(t, offset, 50, "Got wrong offset")
+	}
+}
+
+func TestSeqTree_Apply(t *testing.T) {
+	s := NewSeqTree()
+	s.Apply(func(t *Tree) {
+		for key := 0; key < 1000; key++ {
+			t.Put(key, 2)
+		}
+	})
+	assert.Equal(t, s.Size(), 1000, "Wrong number of nodes")
+	assert.Equal(t, s.Total(), 2000, "Wrong total amount")
+	assert.Equal(t, s.Seq(), uint64(1), "Batch published more than one write")
+
+	before := s.load()
+	s.Apply(func(t *Tree) {
+		t.Remove(0)
+		t.Put(1000, 2)
+	})
+	assert.Equal(t, before.Size(), 1000, "Published tree changed")
+	assert.Equal(t, before.Total(), 2000, "Published tree changed")
+	assert.Equal(t, s.Seq(), uint64(2), "Wrong number of writes")
+	{
+		_, offset, ok := s.Get(1000)
+		assert.Equal(t, ok, true, "Not found but inserted")
+		assert.Equal(t, offset, 1998, "Got wrong offset")
+	}
+}
@@ -0,0 +1,54 @@
+package soseg
+
+// Snapshot is an immutable copy of a tree.
+// It can be read from any number of goroutines
+// while the tree it was taken from keeps changing.
+type Snapshot struct {
+	tree *Tree
+}
+
+var _ Reader = (*Snapshot)(nil)
+
+// Snapshot returns an immutable copy of the tree in O(n).
+func (t *Tree) Snapshot() *Snapshot {
+	return &Snapshot{tree: t.Clone()}
+}
+
+// Get is the snapshot version of Tree.Get.
+func (s *Snapshot) Get(key int) (size int, offset int, ok bool) {
+	return s.tree.Get(key)
+}
+
+// Find is the snapshot version of Tree.Find.
+func (s *Snapshot) Find(point int) (key int, ok bool) {
+	return s.tree.Find(point)
+}
+
+// Total is the snapshot version of Tree.Total.
+func (s *Snapshot) Total() int {
+	return s.tree.Total()
+}
+
+// Size is the snapshot version of Tree.Size.
+func (s *Snapshot) Size() int {
+	return s.tree.Size()
+}
+
+// FindBatchSnapshot resolves all points against snap,
+// or against a fresh snapshot of the tree if snap is nil.
+// The result is aligned with points, points outside the range yield -1.
+// Trees that use -1 as a key should call Find on the snapshot instead.
+func (t *Tree) FindBatchSnapshot(snap *Snapshot, points []int) []int {
+	if snap == nil {
+		snap = t.Snapshot()
+	}
+	keys := make([]int, len(points))
+	for i, point := range points {
+		key, ok := snap.Find(point)
+		if !ok {
+			key = -1
+		}
+		keys[i] = key
+	}
+	return keys
+}
@@ -0,0 +1,23 @@
+package soseg
+
+import (
+	"github.com/magiconair/properties/assert"
+	"testing"
+)
+
+func TestTree_FindBatchSnapshot(t *testing.T) {
+	var tree Tree
+	tree.Put(0, 1)
+	tree.Put(1, 3)
+	tree.Put(2, 4)
+
+	snap := tree.Snapshot()
+	tree.Remove(1)
+	tree.Put(3, 10)
+
+	points := []int{0, 1, 3, 4, 7, 8, -1}
+	assert.Equal(t, tree.FindBatchSnapshot(snap, points), []int{0, 1, 1, 2, 2, -1, -1}, "Snapshot reflects mutation")
+	assert.Equal(t, tree.FindBatchSnapshot(nil, points), []int{0, 2, 2, 2, 3, 3, -1}, "Fresh snapshot is stale")
+	assert.Equal(t, snap.Total(), 8, "Snapshot total changed")
+	assert.Equal(t, snap.Size(), 3, "Snapshot size changed")
+}
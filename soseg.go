@@ -1,7 +1,17 @@
 // Package soseg implements a sorted sum tree
 package soseg
 
-import "fmt"
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"math/bits"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+)
 
 // Tree describes a list of weights sorted by unique keys.
 // The tree also keeps track of the running total/sum of weights preceding each entry.
@@ -10,6 +20,56 @@ import "fmt"
 type Tree struct {
 	Root *Node
 	size int
+	free *Node // retained nodes linked by Parent
+	less func(a, b int) bool
+
+	// Cached smallest and largest keys, valid if size > 0
+	min, max int
+
+	// Height limit factor, and an upper bound of Height() that only rebuilds lower
+	maxHeightFactor float64
+	height          int
+
+	// Weight balance bound of targeted rebuilds, and the size since the last full rebuild
+	rebuildAlpha float64
+	maxSize      int
+
+	// Mutations recorded since the last DrainChangelog if logging is enabled,
+	// and the number of all mutations
+	logging   bool
+	changelog []Op
+	version   uint64
+
+	// Recently found keys by point, invalidated by any mutation
+	cache *findCache
+
+	// Nodes visited by the last Find, Get or Put if step counting is enabled
+	stepCounting bool
+	steps        int
+}
+
+// Reader is the read-only subset of the Tree methods.
+type Reader interface {
+	Get(key int) (size int, offset int, ok bool)
+	Find(point int) (key int, ok bool)
+	Total() int
+	Size() int
+}
+
+var _ Reader = (*Tree)(nil)
+
+// NewWithLess returns an empty tree that orders keys by less instead of <.
+// less must define a strict total order on the keys.
+func NewWithLess(less func(a, b int) bool) *Tree {
+	return &Tree{less: less}
+}
+
+// lt reports whether key a sorts before key b.
+func (t *Tree) lt(a, b int) bool {
+	if t.less == nil {
+		return a < b
+	}
+	return t.less(a, b)
 }
 
 // A Node can be either a branch with two children or a leaf.
@@ -22,58 +82,266 @@ type Node struct {
 	Parent   *Node
 	Children [2]*Node
 	Terminal bool
+
+	// Number of keys after Key that a leaf added by PutRange also covers,
+	// each weighing Value/(span+1)
+	span int
+}
+
+// Entry describes a single leaf of the tree.
+// Offset is the sum of the weights of all preceding entries.
+type Entry struct {
+	Key    int
+	Size   int
+	Offset int
+}
+
+// NewFromEntries builds a balanced tree from entries in O(n).
+// The entries must be sorted by strictly ascending key and have positive sizes.
+// Their offsets are ignored.
+func NewFromEntries(entries []Entry) (*Tree, error) {
+	for i, e := range entries {
+		if e.Size <= 0 {
+			return nil, errorf(ErrNonPositiveWeight, "soseg: non-positive size %d for key %d", e.Size, e.Key)
+		}
+		if i > 0 && e.Key == entries[i-1].Key {
+			return nil, errorf(ErrDuplicateKey, "soseg: duplicate key %d", e.Key)
+		}
+		if i > 0 && e.Key < entries[i-1].Key {
+			return nil, errorf(ErrOutOfRange, "soseg: key %d not sorted after key %d", e.Key, entries[i-1].Key)
+		}
+	}
+	t := new(Tree)
+	t.build(entries)
+	return t, nil
+}
+
+// NewFromCounts builds a balanced tree from a map of keys to positive counts
+// in O(n log n), e.g. to sample keys proportionally to how often they occurred.
+func NewFromCounts(counts map[int]int) (*Tree, error) {
+	entries := make([]Entry, 0, len(counts))
+	for key, count := range counts {
+		if count <= 0 {
+			return nil, errorf(ErrNonPositiveWeight, "soseg: non-positive count %d for key %d", count, key)
+		}
+		entries = append(entries, Entry{Key: key, Size: count})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Key < entries[j].Key
+	})
+	t := new(Tree)
+	t.build(entries)
+	return t, nil
+}
+
+// build replaces the contents of the tree with a balanced tree of sorted entries.
+func (t *Tree) build(entries []Entry) {
+	leaves := make([]Node, len(entries))
+	for i, e := range entries {
+		leaves[i] = Node{Key: e.Key, Value: e.Size}
+	}
+	t.buildLeaves(leaves)
+}
+
+// buildLeaves is like build but takes sorted leaves,
+// of which only the Key, Value and key range are used.
+func (t *Tree) buildLeaves(leaves []Node) {
+	t.Root = nil
+	t.size = 0
+	for i := range leaves {
+		t.size += leaves[i].span + 1
+	}
+	t.maxSize = t.size
+	t.height = 0
+	if len(leaves) > 0 {
+		t.height = bits.Len(uint(len(leaves)-1)) + 1
+		t.Root = t.buildNode(leaves, nil)
+		t.min = leaves[0].Key
+		t.max = leaves[len(leaves)-1].last()
+	}
+}
+
+func (t *Tree) buildNode(leaves []Node, parent *Node) *Node {
+	if len(leaves) == 1 {
+		return t.alloc(Node{
+			Key:      leaves[0].Key,
+			Value:    leaves[0].Value,
+			Parent:   parent,
+			Terminal: true,
+			span:     leaves[0].span,
+		})
+	}
+	mid := len(leaves) / 2
+	n := t.alloc(Node{
+		Key:    leaves[mid].Key,
+		Parent: parent,
+	})
+	n.Children[0] = t.buildNode(leaves[:mid], n)
+	n.Children[1] = t.buildNode(leaves[mid:], n)
+	n.Value = n.Children[0].Value + n.Children[1].Value
+	return n
+}
+
+// Rebuild restructures the tree into a balanced tree in O(n).
+func (t *Tree) Rebuild() {
+	var leaves []Node
+	t.leaves(func(n *Node) bool {
+		leaves = append(leaves, Node{Key: n.Key, Value: n.Value, span: n.span})
+		return true
+	})
+	t.buildLeaves(leaves)
+}
+
+// RebuildContext is like Rebuild but checks ctx while collecting the leaves
+// and returns ctx.Err() once it is done, leaving the tree unchanged.
+// Once all leaves are collected the rebuild runs to completion.
+func (t *Tree) RebuildContext(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	var leaves []Node
+	var err error
+	t.leaves(func(n *Node) bool {
+		if len(leaves)%1024 == 1023 {
+			if err = ctx.Err(); err != nil {
+				return false
+			}
+		}
+		leaves = append(leaves, Node{Key: n.Key, Value: n.Value, span: n.span})
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	t.buildLeaves(leaves)
+	return nil
+}
+
+// Height returns the number of nodes on the longest path from the root to a leaf in O(n).
+// A single leaf has height 1 and an empty tree has height 0.
+func (t *Tree) Height() int {
+	if t.Root == nil {
+		return 0
+	}
+	return t.Root.height()
+}
+
+func (n *Node) height() int {
+	if n.Terminal {
+		return 1
+	}
+	h0, h1 := n.Children[0].height(), n.Children[1].height()
+	if h0 > h1 {
+		return h0 + 1
+	}
+	return h1 + 1
+}
+
+// SetMaxHeightFactor makes Put and Remove rebuild the tree once Height() exceeds
+// f times the height of a balanced tree of Size() keys, ceil(log2(Size()))+1,
+// but it always allows at least one level above the balanced height,
+// so that a factor close to 1 does not rebuild on every insertion.
+// The check costs O(1) using an upper bound of the height tracked by insertions,
+// rebuilds cost O(n) but are amortized. Factors of at most 1, such as 0,
+// disable automatic rebuilds.
+func (t *Tree) SetMaxHeightFactor(f float64) {
+	if !(f > 1) {
+		f = 0
+	}
+	t.maxHeightFactor = f
+}
+
+// tooTall reports whether the height bound exceeds the limit set by SetMaxHeightFactor.
+func (t *Tree) tooTall() bool {
+	if t.maxHeightFactor == 0 {
+		return false
+	}
+	balanced := bits.Len(uint(t.size-1)) + 1
+	return t.height > balanced+1 && float64(t.height) > t.maxHeightFactor*float64(balanced)
 }
 
 // Put inserts a node by key with a positive size,
 // or updates the size if a node with this key already exists.
 func (t *Tree) Put(key int, size int) (created bool) {
+	_, existed := t.PutReturning(key, size)
+	return !existed
+}
+
+// PutReturning is like Put but returns the previous size
+// if a node with this key already existed.
+func (t *Tree) PutReturning(key int, size int) (oldSize int, existed bool) {
+	n := t.insert(key, 0, size)
+	if n == nil {
+		t.record(Op{Kind: OpPut, Key: key, Size: size})
+		return 0, false
+	}
+	if n.span > 0 {
+		n = t.isolate(key)
+	}
+	old := n.Value
+	if size != old {
+		n.addBranch(size - old)
+		t.record(Op{Kind: OpPut, Key: key, Size: size})
+	}
+	return old, true
+}
+
+// insert adds a leaf covering the keys [key, key+span] with the specified value
+// and returns nil, unless the leaf reached by the descent already covers key.
+// In that case it returns the existing leaf and leaves the tree unchanged.
+// The new keys must not overlap any other leaf.
+func (t *Tree) insert(key, span, value int) (existing *Node) {
 	if t.Root == nil {
-		t.Root = &Node{
+		t.Root = t.alloc(Node{
 			Key:      key,
-			Value:    size,
+			Value:    value,
 			Terminal: true,
-		}
-		t.size++
-		return
+			span:     span,
+		})
+		t.size += span + 1
+		t.min, t.max = key, key+span
+		t.height = 1
+		return nil
 	}
 
 	np := &t.Root
+	depth := 0
 	for {
 		n := *np
 		if n.Terminal {
 			break
 		}
-		if key < n.Key {
+		depth++
+		if t.lt(key, n.Key) {
 			np = &n.Children[0]
 		} else {
 			np = &n.Children[1]
 		}
 	}
+	t.setSteps(depth + 1)
 
 	n := *np
 
 	// Leaf reached
-	if key == n.Key {
-		old := n.Value
-		n.Value = size
-		n.Parent.addBranch(size - old)
-		return false
+	if n.covers(key) {
+		return n
 	}
 
-	branch := &Node{
+	branch := t.alloc(Node{
 		Value:  n.Value,
 		Parent: n.Parent,
-	}
+	})
 	*np = branch
-	newNode := &Node{
+	newNode := t.alloc(Node{
 		Key:      key,
-		Value:    size,
+		Value:    value,
 		Parent:   branch,
 		Terminal: true,
-	}
+		span:     span,
+	})
 	n.Parent = branch
 
-	if key < n.Key {
+	if t.lt(key, n.Key) {
 		branch.Key = n.Key
 		branch.Children[0] = newNode
 		branch.Children[1] = n
@@ -83,116 +351,738 @@ func (t *Tree) Put(key int, size int) (created bool) {
 		branch.Children[1] = newNode
 	}
 
-	branch.addBranch(size)
-	t.size++
-	return true
+	branch.addBranch(value)
+	t.size += span + 1
+	if t.lt(key, t.min) {
+		t.min = key
+	} else if t.lt(t.max, key+span) {
+		t.max = key + span
+	}
+
+	// The new leaf sits one level below the replaced one
+	// and is the only place where the height can grow.
+	t.height = max(t.height, depth+2)
+	if t.rebuildAlpha > 0 && t.scapegoat(newNode, depth+1) {
+		return nil
+	}
+	if t.tooTall() {
+		t.Rebuild()
+	}
+	return nil
 }
 
 // Get searches for the node with the specified key.
 // It returns the size of the node and its offset (sum of preceding nodes).
 func (t *Tree) Get(key int) (size int, offset int, ok bool) {
-	if t.Root == nil {
+	if t.Root == nil || t.outside(key) {
 		return 0, 0, false
 	}
 
+	// The offset only sums weights preceding key, which are bounded by the total,
+	// so it cannot overflow unless the total itself did
 	n := t.Root
-	for !n.Terminal {
-		if key < n.Key {
+	visited := 1
+	for ; !n.Terminal; visited++ {
+		if t.lt(key, n.Key) {
 			n = n.Children[0]
 		} else {
 			offset += n.Children[0].Value
 			n = n.Children[1]
 		}
 	}
-	if key == n.Key {
-		return n.Value, offset, true
+	t.setSteps(visited)
+	if n.covers(key) {
+		size = n.per()
+		return size, offset + (key-n.Key)*size, true
 	} else {
 		return 0, 0, false
 	}
 }
 
-// Remove removes the node with the specified key.
-func (t *Tree) Remove(key int) (ok bool) {
+// SumBelow returns the combined weight of all keys before key in O(log n),
+// which is the offset of key whether it exists or not.
+func (t *Tree) SumBelow(key int) (sum int) {
 	if t.Root == nil {
-		return false
+		return 0
 	}
 
-	var offset int
-	var side, side2 int
 	n := t.Root
-	for {
-		if n.Terminal {
-			break
+	for !n.Terminal {
+		if t.lt(key, n.Key) {
+			n = n.Children[0]
+		} else {
+			sum += n.Children[0].Value
+			n = n.Children[1]
 		}
-		side2 = side
-		if key < n.Key {
-			side = 0
+	}
+	// Only part of a key range may lie before key
+	if t.lt(n.last(), key) {
+		sum += n.Value
+	} else if n.span > 0 && key > n.Key {
+		sum += (key - n.Key) * n.per()
+	}
+	return sum
+}
+
+// Locate returns the half-open range [start, end) covered by the key,
+// so that Find returns the key for every point in it.
+func (t *Tree) Locate(key int) (start, end int, ok bool) {
+	size, offset, ok := t.Get(key)
+	return offset, offset + size, ok
+}
+
+// SafeGet is like Get but validates each node during the descent,
+// returning an error instead of panicking if the exported node fields
+// have been corrupted. A missing key is also reported as an error.
+func (t *Tree) SafeGet(key int) (size int, offset int, err error) {
+	n := t.Root
+	for depth := 0; n != nil && !n.Terminal; depth++ {
+		left, right := n.Children[0], n.Children[1]
+		switch {
+		case left == nil || right == nil:
+			return 0, 0, errorf(ErrCorrupt, "soseg: corrupt tree: branch %d is missing a child", n.Key)
+		case left.Parent != n || right.Parent != n:
+			return 0, 0, errorf(ErrCorrupt, "soseg: corrupt tree: children of branch %d have wrong parent", n.Key)
+		case left.Value+right.Value != n.Value:
+			return 0, 0, errorf(ErrCorrupt, "soseg: corrupt tree: branch %d value %d is not the sum of its children", n.Key, n.Value)
+		case depth >= t.size:
+			return 0, 0, errorf(ErrCorrupt, "soseg: corrupt tree: deeper than %d nodes", t.size)
+		}
+		if t.lt(key, n.Key) {
+			n = left
 		} else {
-			side = 1
-			offset += n.Children[0].Value
+			offset += left.Value
+			n = right
 		}
-		n = n.Children[side]
 	}
+	if n == nil || !n.covers(key) {
+		return 0, 0, errorf(ErrNotFound, "soseg: key %d not found", key)
+	}
+	size = n.per()
+	return size, offset + (key-n.Key)*size, nil
+}
 
-	if key != n.Key {
-		return false
+// AdjustWeight adds delta to the weight of the node with the specified key.
+// Delta may be negative as long as the resulting weight stays positive,
+// otherwise the adjustment is rejected and the tree is left unchanged.
+// It returns the new weight of the node.
+func (t *Tree) AdjustWeight(key int, delta int) (newSize int, ok bool) {
+	n := t.isolate(key)
+	if n == nil {
+		return 0, false
 	}
-	if n.Parent == nil {
-		t.Root = nil
-		t.size = 0
-		return true
+	if n.Value+delta <= 0 {
+		return n.Value, false
+	}
+	if delta != 0 {
+		n.addBranch(delta)
+		t.record(Op{Kind: OpPut, Key: key, Size: n.Value})
+	}
+	return n.Value, true
+}
+
+// Decrement subtracts delta from the weight of the node with the specified key,
+// removing the node once its weight drops to zero or below, e.g. for reference counting.
+// It returns the new weight and whether the node was removed.
+// Absent keys are left alone.
+func (t *Tree) Decrement(key, delta int) (newSize int, removed bool) {
+	n := t.isolate(key)
+	if n == nil {
+		return 0, false
+	}
+	if n.Value-delta <= 0 {
+		return 0, t.Remove(key)
+	}
+	if delta != 0 {
+		n.addBranch(-delta)
+		t.record(Op{Kind: OpPut, Key: key, Size: n.Value})
+	}
+	return n.Value, false
+}
+
+// MergeFunc inserts all entries of other into the tree.
+// If a key exists in both trees, resolve receives both weights
+// and returns the combined one. A combined weight <= 0 removes the key.
+// Soft-removed keys of other that are missing from the tree are skipped
+// instead of being inserted as dead keys.
+func (t *Tree) MergeFunc(other *Tree, resolve func(key, a, b int) int) {
+	for _, e := range other.Entries() {
+		n := t.isolate(e.Key)
+		if n == nil {
+			if e.Size > 0 {
+				t.Put(e.Key, e.Size)
+			}
+		} else if size := resolve(e.Key, n.Value, e.Size); size > 0 {
+			if size != n.Value {
+				n.addBranch(size - n.Value)
+				t.record(Op{Kind: OpPut, Key: e.Key, Size: size})
+			}
+		} else {
+			t.Remove(e.Key)
+		}
 	}
+}
 
-	var parent *Node
-	var pivot **Node
-	if n.Parent.Parent == nil {
-		parent = nil
-		pivot = &t.Root
+// Rename moves the weight of oldKey to newKey,
+// leaving Total() unchanged. It fails if oldKey is absent or newKey already exists.
+// If newKey sorts between the neighbors of oldKey, the leaf is re-keyed in place,
+// otherwise it is moved to its new position in O(log n).
+func (t *Tree) Rename(oldKey, newKey int) error {
+	n := t.isolate(oldKey)
+	if n == nil {
+		return errorf(ErrNotFound, "soseg: key %d not found", oldKey)
+	}
+	if oldKey == newKey {
+		return nil
+	}
+	if t.Contains(newKey) {
+		return errorf(ErrDuplicateKey, "soseg: key %d already exists", newKey)
+	}
+
+	size := n.Value
+	prev, next := n.adjacent(0), n.adjacent(1)
+	if (prev == nil || t.lt(prev.last(), newKey)) && (next == nil || t.lt(newKey, next.Key)) {
+		// The only branch keyed by oldKey is the one whose right subtree starts with n
+		for c := n; c.Parent != nil; c = c.Parent {
+			if c.Parent.Children[1] == c && c.Parent.Key == oldKey {
+				c.Parent.Key = newKey
+				break
+			}
+		}
+		n.Key = newKey
 	} else {
-		parent = n.Parent.Parent
-		pivot = &n.Parent.Parent.Children[side2]
+		t.unlink(n)
+		t.insert(newKey, 0, size)
+	}
+	t.updateBounds()
+	t.record(Op{Kind: OpRename, Key: oldKey, Last: newKey, Size: size})
+	return nil
+}
+
+// SwapWeights exchanges the weights of two existing keys.
+// It returns false and leaves the tree unchanged if either key is absent.
+func (t *Tree) SwapWeights(keyA, keyB int) bool {
+	// Isolating one key may rebuild the tree and invalidate the other leaf
+	if t.isolate(keyA) == nil || t.isolate(keyB) == nil {
+		return false
+	}
+	a, b := t.leaf(keyA), t.leaf(keyB)
+	delta := b.Value - a.Value
+	if delta != 0 {
+		a.addBranch(delta)
+		b.addBranch(-delta)
+		t.record(Op{Kind: OpPut, Key: keyA, Size: a.Value})
+		t.record(Op{Kind: OpPut, Key: keyB, Size: b.Value})
+	}
+	return true
+}
+
+// Remove removes the node with the specified key.
+func (t *Tree) Remove(key int) (ok bool) {
+	n := t.isolate(key)
+	if n == nil {
+		return false
+	}
+	t.unlink(n)
+	if t.Root != nil && (key == t.min || key == t.max) {
+		t.updateBounds()
+	}
+	t.record(Op{Kind: OpRemove, Key: key})
+
+	// Removals never deepen the tree, but the height bound shrinks with the size
+	if t.rebuildAlpha > 0 && float64(t.size) < t.rebuildAlpha*float64(t.maxSize) || t.Root != nil && t.tooTall() {
+		t.Rebuild()
+	}
+	return true
+}
+
+// unlink removes the leaf n by replacing its parent with its sibling.
+// The cached Min and Max are left for the caller to update.
+func (t *Tree) unlink(n *Node) {
+	t.size -= n.span + 1
+	parent := n.Parent
+	if parent == nil {
+		t.Root = nil
+		return
 	}
 
 	// Replace parent with neighbor
-	neighbor := n.Parent.Children[1-side]
+	side := 0
+	if parent.Children[1] == n {
+		side = 1
+	}
+	neighbor := parent.Children[1-side]
+	pivot := &t.Root
+	if parent.Parent != nil {
+		pivot = &parent.Parent.Children[1]
+		if parent.Parent.Children[0] == parent {
+			pivot = &parent.Parent.Children[0]
+		}
+	}
 	*pivot = neighbor
-	neighbor.Parent = parent
+	neighbor.Parent = parent.Parent
 	neighbor.Parent.addBranch(-n.Value)
-	t.size--
+
+	// The key of the branch above whose right subtree started with n
+	// must stay the smallest key of that subtree, so that all keys
+	// of a range covered by one leaf descend to that leaf.
+	if side == 0 {
+		for c := neighbor; c.Parent != nil; c = c.Parent {
+			if c.Parent.Children[1] == c {
+				c.Parent.Key = neighbor.edge(0).Key
+				break
+			}
+		}
+	}
+}
+
+// adjacent returns the leaf next to the leaf n on the specified side, or nil if n is the edge.
+func (n *Node) adjacent(side int) *Node {
+	c := n
+	for c.Parent != nil && c.Parent.Children[side] == c {
+		c = c.Parent
+	}
+	if c.Parent == nil {
+		return nil
+	}
+	return c.Parent.Children[side].edge(1 - side)
+}
+
+// updateBounds recomputes the cached Min and Max of a non-empty tree.
+func (t *Tree) updateBounds() {
+	t.min = t.Root.edge(0).Key
+	t.max = t.Root.edge(1).last()
+}
+
+// RemoveBatch removes all nodes with the specified keys
+// and returns how many of them existed.
+// Large batches rebuild the tree in a single O(n) pass instead of removing one by one,
+// which also leaves it balanced.
+func (t *Tree) RemoveBatch(keys []int) (removed int) {
+	if len(keys) < t.size/4 {
+		for _, key := range keys {
+			if t.Remove(key) {
+				removed++
+			}
+		}
+		return removed
+	}
+
+	drop := make(map[int]bool, len(keys))
+	for _, key := range keys {
+		drop[key] = true
+	}
+	var leaves []Node
+	t.leaves(func(n *Node) bool {
+		// Split key ranges around the dropped keys
+		per, from := n.per(), 0
+		for i := 0; i <= n.span; i++ {
+			if drop[n.Key+i] {
+				if i > from {
+					leaves = append(leaves, Node{Key: n.Key + from, Value: (i - from) * per, span: i - from - 1})
+				}
+				from = i + 1
+				removed++
+				t.record(Op{Kind: OpRemove, Key: n.Key + i})
+			}
+		}
+		if from <= n.span {
+			leaves = append(leaves, Node{Key: n.Key + from, Value: (n.span + 1 - from) * per, span: n.span - from})
+		}
+		return true
+	})
+	t.buildLeaves(leaves)
+	return removed
+}
+
+// TrimToSize removes the first keys in the tree order until Size() <= maxEntries
+// and returns how many were removed, e.g. to evict the oldest of ascending IDs.
+// Large trims rebuild the tree from the surviving leaves in a single O(n) pass.
+func (t *Tree) TrimToSize(maxEntries int) (removed int) {
+	drop := t.size - max(maxEntries, 0)
+	if drop <= 0 {
+		return 0
+	}
+	if drop < t.size/4 {
+		for ; removed < drop; removed++ {
+			t.Remove(t.min)
+		}
+		return removed
+	}
+
+	var leaves []Node
+	t.leaves(func(n *Node) bool {
+		per, from := n.per(), 0
+		for ; removed < drop && from <= n.span; from++ {
+			removed++
+			t.record(Op{Kind: OpRemove, Key: n.Key + from})
+		}
+		if from <= n.span {
+			leaves = append(leaves, Node{Key: n.Key + from, Value: (n.span + 1 - from) * per, span: n.span - from})
+		}
+		return true
+	})
+	t.buildLeaves(leaves)
+	return removed
+}
+
+// SoftRemove sets the weight of the node with the specified key to zero
+// without restructuring the tree. The tombstoned key can no longer be found
+// by points or sampled, but stays part of the tree until Compact.
+func (t *Tree) SoftRemove(key int) (ok bool) {
+	n := t.isolate(key)
+	if n == nil {
+		return false
+	}
+	if n.Value != 0 {
+		n.addBranch(-n.Value)
+		t.record(Op{Kind: OpPut, Key: key})
+	}
 	return true
 }
 
+// Compact removes all tombstoned nodes left by SoftRemove in a single O(n) pass,
+// leaving the tree balanced. It returns the number of removed nodes.
+func (t *Tree) Compact() (removed int) {
+	var leaves []Node
+	t.leaves(func(n *Node) bool {
+		if n.Value == 0 {
+			removed++
+			t.record(Op{Kind: OpRemove, Key: n.Key})
+		} else {
+			leaves = append(leaves, Node{Key: n.Key, Value: n.Value, span: n.span})
+		}
+		return true
+	})
+	if removed > 0 {
+		t.buildLeaves(leaves)
+	}
+	return removed
+}
+
 // Find returns the key with the range containing the specified point in O(log n).
+// The ranges only depend on the entries, so trees that are Equal
+// return the same key for every point regardless of their shape.
 func (t *Tree) Find(point int) (key int, ok bool) {
-	if t.Root == nil {
+	if t.cache != nil {
+		if key, ok := t.cache.get(point, t.version); ok {
+			t.setSteps(0)
+			return key, true
+		}
+	}
+	n, offset := t.find(point)
+	if n == nil {
 		return 0, false
 	}
+	key = n.keyAt(point - offset)
+	if t.cache != nil {
+		t.cache.put(point, key)
+	}
+	return key, true
+}
 
-	if point < 0 {
+// FindWrap is like Find but wraps any point around modulo Total(),
+// like the positions on a ring, so it only fails for an empty tree.
+func (t *Tree) FindWrap(point int) (key int, ok bool) {
+	total := t.Total()
+	if total <= 0 {
 		return 0, false
 	}
+	point %= total
+	if point < 0 {
+		point += total
+	}
+	return t.Find(point)
+}
 
-	var offset int
+// FindEntry is like Find but returns the whole entry of the range
+// containing the specified point.
+func (t *Tree) FindEntry(point int) (Entry, bool) {
+	n, offset := t.find(point)
+	if n == nil {
+		return Entry{}, false
+	}
+	key := n.keyAt(point - offset)
+	size := n.per()
+	return Entry{Key: key, Size: size, Offset: offset + (key-n.Key)*size}, true
+}
+
+// FindBoundary is like Find but also reports points on the boundary between two ranges.
+// If point is the start of a range other than the first, it returns the key
+// of the range ending there as lower and the key of the range starting there as upper.
+// Otherwise both are the key of the range containing point.
+// Points outside the total tree range return zero keys.
+func (t *Tree) FindBoundary(point int) (lower, upper int, onBoundary bool) {
+	e, ok := t.FindEntry(point)
+	if !ok {
+		return 0, 0, false
+	}
+	if e.Offset == point && point > 0 {
+		if prev, ok := t.FindEntry(point - 1); ok {
+			return prev.Key, e.Key, true
+		}
+	}
+	return e.Key, e.Key, false
+}
+
+// FindTrace is like Find but also returns the keys of the branches
+// visited during the descent, starting at the root.
+// The path is empty for a single-leaf tree.
+func (t *Tree) FindTrace(point int) (key int, path []int, ok bool) {
+	if t.Root == nil || t.Root.Value <= 0 || point < 0 {
+		return 0, nil, false
+	}
+
+	rel := point
 	n := t.Root
 	for !n.Terminal {
+		if rel >= n.Value {
+			return 0, path, false
+		}
+		path = append(path, n.Key)
+
+		left := n.Children[0].Value
+		if rel < left {
+			n = n.Children[0]
+		} else {
+			rel -= left
+			n = n.Children[1]
+		}
+	}
+	if rel >= n.Value {
+		return 0, path, false
+	}
+	return n.keyAt(rel), path, true
+}
+
+// find returns the leaf with the range containing the specified point
+// and the offset of that range, or nil if the point is out of range.
+func (t *Tree) find(point int) (leaf *Node, offset int) {
+	// A non-positive total, e.g. after the weights overflowed, has no valid ranges
+	if t.Root == nil || t.Root.Value <= 0 {
+		return nil, 0
+	}
+
+	if point < 0 {
+		return nil, 0
+	}
+
+	// Track the point relative to the current subtree
+	// so that no intermediate sum can overflow.
+	rel := point
+	n := t.Root
+	visited := 1
+	for ; !n.Terminal; visited++ {
 		// Point outside the total tree range
-		if point > offset+n.Value {
-			return 0, false
+		if rel >= n.Value {
+			t.setSteps(visited)
+			return nil, 0
 		}
 
-		mid := offset + n.Children[0].Value
-		if point < mid {
+		left := n.Children[0].Value
+		if rel < left {
 			n = n.Children[0]
 		} else {
-			offset = mid
+			rel -= left
+			offset += left
 			n = n.Children[1]
 		}
 	}
-	if point >= offset+n.Value {
+	t.setSteps(visited)
+	if rel >= n.Value {
+		return nil, 0
+	}
+
+	return n, offset
+}
+
+// FindNearestMidpoint returns the key whose range midpoint (start+size/2)
+// is closest to the specified point in O(log n).
+// Points outside the total tree range snap to the nearest end.
+// On a tie the range containing the point wins, otherwise the smaller key.
+func (t *Tree) FindNearestMidpoint(point int) (key int, ok bool) {
+	total := t.Total()
+	if total <= 0 {
+		return 0, false
+	}
+
+	// Clamping does not change the outcome but keeps distances from overflowing
+	if point < 0 {
+		point = 0
+	} else if point >= total {
+		point = total - 1
+	}
+	e, ok := t.FindEntry(point)
+	if !ok {
+		return 0, false
+	}
+
+	key = e.Key
+	best := abs(point - (e.Offset + e.Size/2))
+	if prev, ok := t.FindEntry(e.Offset - 1); ok {
+		if d := abs(point - (prev.Offset + prev.Size/2)); d < best {
+			key, best = prev.Key, d
+		}
+	}
+	if next, ok := t.FindEntry(e.Offset + e.Size); ok {
+		if d := abs(point - (next.Offset + next.Size/2)); d < best {
+			key = next.Key
+		}
+	}
+	return key, true
+}
+
+// FindWindow returns the keys whose ranges overlap [point-radius, point+radius]
+// in key order in O(log n + k) for k returned keys.
+// The window is clamped to the total tree range,
+// so it is empty for a negative radius or a window outside of that range.
+func (t *Tree) FindWindow(point, radius int) []int {
+	total := t.Total()
+	if total <= 0 || radius < 0 {
+		return nil
+	}
+
+	// Clamp without computing point±radius, which may overflow
+	lo, hi := 0, total-1
+	if point > radius {
+		lo = point - radius
+	}
+	if point < total-1-radius {
+		hi = point + radius
+	}
+	if lo > hi {
+		return nil
+	}
+	return t.Root.window(lo, hi, 0, nil)
+}
+
+// window appends the keys whose ranges overlap [lo, hi] to keys,
+// skipping subtrees whose ranges lie outside the interval.
+func (n *Node) window(lo, hi, offset int, keys []int) []int {
+	if n.Terminal {
+		first, last := max(lo-offset, 0), min(hi-offset, n.Value-1)
+		if first > last {
+			return keys
+		}
+		// Count keys relative to n.Key, which cannot wrap around at math.MaxInt
+		per := n.per()
+		for i := first / per; i <= last/per; i++ {
+			keys = append(keys, n.Key+i)
+		}
+		return keys
+	}
+	left := n.Children[0].Value
+	if lo < offset+left {
+		keys = n.Children[0].window(lo, hi, offset, keys)
+	}
+	if hi >= offset+left {
+		keys = n.Children[1].window(lo, hi, offset+left, keys)
+	}
+	return keys
+}
+
+// Contains reports whether a node with the specified key exists.
+func (t *Tree) Contains(key int) bool {
+	return t.leaf(key) != nil
+}
+
+// Min returns the first key in the tree order in O(1).
+func (t *Tree) Min() (key int, ok bool) {
+	if t.Root == nil {
+		return 0, false
+	}
+	return t.min, true
+}
+
+// Max returns the last key in the tree order in O(1).
+func (t *Tree) Max() (key int, ok bool) {
+	if t.Root == nil {
+		return 0, false
+	}
+	return t.max, true
+}
+
+// Successor returns the first key after the specified key in the tree order
+// in O(log n). The specified key does not need to exist.
+func (t *Tree) Successor(key int) (next int, ok bool) {
+	if t.Root == nil {
 		return 0, false
 	}
+	t.Root.leavesAfter(t, key, 0, func(n *Node, _ int) bool {
+		next, ok = n.Key, true
+		if n.span > 0 && key >= n.Key {
+			next = key + 1
+		}
+		return false
+	})
+	return next, ok
+}
+
+// AreAdjacent reports whether both keys exist and one of them
+// is the Successor of the other, so that no key lies between them.
+func (t *Tree) AreAdjacent(keyA, keyB int) bool {
+	if t.lt(keyB, keyA) {
+		keyA, keyB = keyB, keyA
+	}
+	if !t.Contains(keyA) || !t.Contains(keyB) {
+		return false
+	}
+	next, ok := t.Successor(keyA)
+	return ok && next == keyB
+}
+
+// KeySpan returns both Min and Max in O(1).
+func (t *Tree) KeySpan() (min, max int, ok bool) {
+	if t.Root == nil {
+		return 0, 0, false
+	}
+	return t.min, t.max, true
+}
+
+// outside reports whether key lies outside [Min, Max],
+// so that lookups can fail without a descent.
+func (t *Tree) outside(key int) bool {
+	return t.lt(key, t.min) || t.lt(t.max, key)
+}
+
+// edge returns the outermost leaf on the specified side of the subtree.
+func (n *Node) edge(side int) *Node {
+	for !n.Terminal {
+		n = n.Children[side]
+	}
+	return n
+}
+
+// IsDense reports whether the keys form a contiguous run of integers
+// from Min to Max without gaps. It returns false for an empty tree.
+func (t *Tree) IsDense() bool {
+	min, ok := t.Min()
+	if !ok {
+		return false
+	}
+	max, _ := t.Max()
+
+	// The distance between extreme keys overflows int, but not uint64
+	span := uint64(max) - uint64(min)
+	if max < min {
+		span = uint64(min) - uint64(max)
+	}
+	return span == uint64(t.size-1)
+}
 
-	return n.Key, true
+// Append inserts a node with the next available key (Max+1, or 0 for an empty tree)
+// and returns the assigned key.
+// It returns false without changing the tree if Max is already math.MaxInt.
+// It assumes the native key ordering.
+func (t *Tree) Append(size int) (key int, ok bool) {
+	if max, ok := t.Max(); ok {
+		if max == math.MaxInt {
+			return 0, false
+		}
+		key = max + 1
+	}
+	t.Put(key, size)
+	return key, true
 }
 
 // Total returns the sum of all weights in O(1).
@@ -203,6 +1093,35 @@ func (t *Tree) Total() int {
 	return t.Root.Value
 }
 
+// leaf returns the leaf with the specified key or nil.
+func (t *Tree) leaf(key int) *Node {
+	if t.Root == nil || t.outside(key) {
+		return nil
+	}
+
+	n := t.Root
+	for !n.Terminal {
+		if t.lt(key, n.Key) {
+			n = n.Children[0]
+		} else {
+			n = n.Children[1]
+		}
+	}
+	if !n.covers(key) {
+		return nil
+	}
+	return n
+}
+
+// resum recomputes the Values of all branches below and including n
+// from their leaves and returns the new Value of n.
+func (n *Node) resum() int {
+	if !n.Terminal {
+		n.Value = n.Children[0].resum() + n.Children[1].resum()
+	}
+	return n.Value
+}
+
 func (n *Node) addBranch(delta int) {
 	x := n
 	for x != nil {
@@ -221,33 +1140,384 @@ func (t *Tree) Size() int {
 	return t.size
 }
 
+// Entries returns all entries in key order.
+func (t *Tree) Entries() []Entry {
+	return t.AppendEntries(make([]Entry, 0, t.size))
+}
+
+// AppendEntries appends all entries in key order to dst
+// and returns the extended slice.
+func (t *Tree) AppendEntries(dst []Entry) []Entry {
+	var offset int
+	t.each(func(key, size int) bool {
+		dst = append(dst, Entry{Key: key, Size: size, Offset: offset})
+		offset += size
+		return true
+	})
+	return dst
+}
+
+// Page returns up to limit entries with keys after afterKey in key order
+// in O(log n + limit), together with the key to pass as afterKey for the next page
+// and whether more entries follow. Use FirstPage for the first page.
+func (t *Tree) Page(afterKey int, limit int) (entries []Entry, nextKey int, hasMore bool) {
+	return t.page(&afterKey, limit)
+}
+
+// FirstPage is like Page but starts at the first key in the tree order,
+// which also works for a custom ordering and lists a key equal to math.MinInt.
+// The next key is 0 if the page is empty.
+func (t *Tree) FirstPage(limit int) (entries []Entry, nextKey int, hasMore bool) {
+	return t.page(nil, limit)
+}
+
+// page implements Page, starting at the first key if afterKey is nil.
+func (t *Tree) page(afterKey *int, limit int) (entries []Entry, nextKey int, hasMore bool) {
+	if afterKey != nil {
+		nextKey = *afterKey
+	}
+	if t.Root == nil {
+		return nil, nextKey, false
+	}
+	visit := func(n *Node, offset int) bool {
+		size, first := n.per(), 0
+		if afterKey != nil && n.span > 0 && *afterKey >= n.Key {
+			first = *afterKey - n.Key + 1
+		}
+		for i := first; i <= n.span; i++ {
+			if len(entries) == limit {
+				hasMore = true
+				return false
+			}
+			nextKey = n.Key + i
+			entries = append(entries, Entry{Key: nextKey, Size: size, Offset: offset + i*size})
+		}
+		return true
+	}
+	if afterKey != nil {
+		t.Root.leavesAfter(t, *afterKey, 0, visit)
+		return entries, nextKey, hasMore
+	}
+	offset := 0
+	t.leaves(func(n *Node) bool {
+		if !visit(n, offset) {
+			return false
+		}
+		offset += n.Value
+		return true
+	})
+	return entries, nextKey, hasMore
+}
+
+// leavesAfter calls fn for each leaf covering keys after key in key order
+// together with its offset until fn returns false,
+// skipping the subtrees before key.
+func (n *Node) leavesAfter(t *Tree, key, offset int, fn func(n *Node, offset int) bool) bool {
+	if n.Terminal {
+		return !t.lt(key, n.last()) || fn(n, offset)
+	}
+	left := n.Children[0]
+	if t.lt(key, n.Key) && !left.leavesAfter(t, key, offset, fn) {
+		return false
+	}
+	return n.Children[1].leavesAfter(t, key, offset+left.Value, fn)
+}
+
+// ForEachByWeight calls fn for each entry ordered by weight, ties ordered by key,
+// until fn returns false. Since the tree is not ordered by weight,
+// it allocates and sorts a copy of all entries in O(n log n).
+func (t *Tree) ForEachByWeight(descending bool, fn func(key, size int) bool) {
+	entries := t.Entries()
+	sort.SliceStable(entries, func(i, j int) bool {
+		if descending {
+			return entries[i].Size > entries[j].Size
+		}
+		return entries[i].Size < entries[j].Size
+	})
+	for _, e := range entries {
+		if !fn(e.Key, e.Size) {
+			return
+		}
+	}
+}
+
+// Subtree returns a new balanced tree containing the entries
+// with keys in [lo, hi]. The original tree is left unchanged.
+func (t *Tree) Subtree(lo, hi int) *Tree {
+	var leaves []Node
+	if t.Root != nil {
+		leaves = t.Root.collect(t, lo, hi, leaves)
+	}
+	sub := &Tree{less: t.less}
+	sub.buildLeaves(leaves)
+	return sub
+}
+
+// collect appends copies of the leaves with keys in [lo, hi] to leaves,
+// skipping subtrees that lie outside the interval.
+// Key ranges are clipped to the interval.
+func (n *Node) collect(t *Tree, lo, hi int, leaves []Node) []Node {
+	if n.Terminal {
+		first, last := n.Key, n.last()
+		if n.span > 0 {
+			first, last = max(first, lo), min(last, hi)
+		}
+		if !t.lt(last, lo) && !t.lt(hi, first) {
+			leaves = append(leaves, Node{Key: first, Value: (last - first + 1) * n.per(), span: last - first})
+		}
+		return leaves
+	}
+	if t.lt(lo, n.Key) {
+		leaves = n.Children[0].collect(t, lo, hi, leaves)
+	}
+	if !t.lt(hi, n.Key) {
+		leaves = n.Children[1].collect(t, lo, hi, leaves)
+	}
+	return leaves
+}
+
+// Columns returns the keys and sizes of all nodes
+// as two aligned slices in key order.
+func (t *Tree) Columns() (keys []int, sizes []int) {
+	keys = make([]int, 0, t.size)
+	sizes = make([]int, 0, t.size)
+	t.each(func(key, size int) bool {
+		keys = append(keys, key)
+		sizes = append(sizes, size)
+		return true
+	})
+	return keys, sizes
+}
+
+// Boundaries returns the cumulative boundaries of all ranges in key order.
+// The i-th range is [b[i], b[i+1]), so the slice has Size()+1 elements
+// starting at 0 and ending at Total().
+func (t *Tree) Boundaries() []int {
+	b := make([]int, 1, t.size+1)
+	t.each(func(_, size int) bool {
+		b = append(b, b[len(b)-1]+size)
+		return true
+	})
+	return b
+}
+
+// leaves calls fn for each leaf in key order until fn returns false.
+func (t *Tree) leaves(fn func(n *Node) bool) {
+	if t.Root != nil {
+		t.Root.leaves(fn)
+	}
+}
+
+func (n *Node) leaves(fn func(n *Node) bool) bool {
+	if n.Terminal {
+		return fn(n)
+	}
+	return n.Children[0].leaves(fn) && n.Children[1].leaves(fn)
+}
+
+// NodeView is a read-only copy of a node visited by Walk.
+type NodeView struct {
+	Key    int
+	Value  int
+	IsLeaf bool
+	Depth  int
+}
+
+// Walk visits all nodes including branches in pre-order, starting at the root with depth 0.
+// Returning false from fn skips the children of the visited node.
+func (t *Tree) Walk(fn func(n NodeView, depth int) bool) {
+	if t.Root != nil {
+		t.Root.walk(fn, 0)
+	}
+}
+
+func (n *Node) walk(fn func(n NodeView, depth int) bool, depth int) {
+	view := NodeView{Key: n.Key, Value: n.Value, IsLeaf: n.Terminal, Depth: depth}
+	if fn(view, depth) && !n.Terminal {
+		n.Children[0].walk(fn, depth+1)
+		n.Children[1].walk(fn, depth+1)
+	}
+}
+
+// Equal reports whether both trees contain the same keys with the same weights,
+// regardless of their shape.
+func (t *Tree) Equal(other *Tree) bool {
+	if t.size != other.size || t.Total() != other.Total() {
+		return false
+	}
+	a, b := t.Entries(), other.Entries()
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// StructurallyEqual reports whether both trees have the same shape
+// with the same keys and values on every node, including the branches.
+// Unlike Equal, it tells apart trees holding the same entries in different shapes.
+func (t *Tree) StructurallyEqual(other *Tree) bool {
+	if t.Root == nil || other.Root == nil {
+		return t.Root == other.Root
+	}
+	return t.Root.structurallyEqual(other.Root)
+}
+
+func (n *Node) structurallyEqual(o *Node) bool {
+	if n.Key != o.Key || n.Value != o.Value || n.Terminal != o.Terminal || n.span != o.span {
+		return false
+	}
+	return n.Terminal ||
+		n.Children[0].structurallyEqual(o.Children[0]) && n.Children[1].structurallyEqual(o.Children[1])
+}
+
+// Warm reads every node of the tree once to fault in its memory
+// and populate the CPU caches, e.g. before serving samples after a bulk load.
+// Like other reads it is safe to call concurrently with readers.
+func (t *Tree) Warm() {
+	if t.Root != nil {
+		// Keep the compiler from eliding the reads without sharing the result
+		sum := t.Root.warm()
+		runtime.KeepAlive(sum)
+	}
+}
+
+func (n *Node) warm() int {
+	if n.Terminal {
+		return n.Key ^ n.Value
+	}
+	return n.Value ^ n.Children[0].warm() ^ n.Children[1].warm()
+}
+
+// Clone returns a deep copy of the tree in O(n).
+func (t *Tree) Clone() *Tree {
+	c := &Tree{
+		size:            t.size,
+		less:            t.less,
+		min:             t.min,
+		max:             t.max,
+		maxHeightFactor: t.maxHeightFactor,
+		height:          t.height,
+		rebuildAlpha:    t.rebuildAlpha,
+		maxSize:         t.maxSize,
+	}
+	if t.Root != nil {
+		c.Root = t.Root.clone(nil)
+	}
+	return c
+}
+
+func (n *Node) clone(parent *Node) *Node {
+	c := &Node{
+		Key:      n.Key,
+		Value:    n.Value,
+		Parent:   parent,
+		Terminal: n.Terminal,
+		span:     n.span,
+	}
+	if !n.Terminal {
+		c.Children[0] = n.Children[0].clone(c)
+		c.Children[1] = n.Children[1].clone(c)
+	}
+	return c
+}
+
 // Clear removes all nodes from the tree.
 func (t *Tree) Clear() {
+	if t.Root != nil {
+		t.record(Op{Kind: OpClear})
+	}
+	t.Root = nil
+	t.size = 0
+	t.maxSize = 0
+	t.free = nil
+}
+
+// ClearRetain removes all nodes from the tree like Clear,
+// but keeps their allocations for reuse by subsequent Puts.
+// Node pointers obtained before the call must not be used afterwards.
+func (t *Tree) ClearRetain() {
+	if t.Root != nil {
+		t.Root.retain(&t.free)
+		t.record(Op{Kind: OpClear})
+	}
 	t.Root = nil
 	t.size = 0
+	t.maxSize = 0
+}
+
+func (n *Node) retain(free **Node) {
+	if !n.Terminal {
+		n.Children[0].retain(free)
+		n.Children[1].retain(free)
+	}
+	*n = Node{Parent: *free}
+	*free = n
+}
+
+// alloc returns a node initialized to v,
+// reusing a retained node if one is available.
+func (t *Tree) alloc(v Node) *Node {
+	n := t.free
+	if n == nil {
+		n = new(Node)
+	} else {
+		t.free = n.Parent
+	}
+	*n = v
+	return n
 }
 
 func (t *Tree) Print() {
-	fmt.Println("SoSeg Tree")
+	t.PrintDepth(-1)
+}
+
+// PrintDepth is like Print but elides subtrees below maxDepth,
+// showing only their aggregate Value. A negative maxDepth prints everything.
+func (t *Tree) PrintDepth(maxDepth int) {
+	t.print(os.Stdout, maxDepth)
+}
+
+// StringDepth returns the output of PrintDepth as a string.
+func (t *Tree) StringDepth(maxDepth int) string {
+	var b strings.Builder
+	t.print(&b, maxDepth)
+	return b.String()
+}
+
+// print writes the output of PrintDepth to w as it walks the tree.
+func (t *Tree) print(w io.Writer, maxDepth int) {
+	io.WriteString(w, "SoSeg Tree\n")
 	if t.Root != nil {
-		t.Root.print(0)
+		t.Root.print(w, 0, maxDepth)
 	}
 }
 
-func (n *Node) print(indent int) {
-	if n.Terminal {
-		printIndent(indent)
-		fmt.Printf("- '%d/%d\n", n.Key, n.Value)
+func (n *Node) print(w io.Writer, indent int, maxDepth int) {
+	printIndent(w, indent)
+	if n.Terminal && n.span > 0 {
+		fmt.Fprintf(w, "- '%d..%d/%d\n", n.Key, n.last(), n.Value)
+	} else if n.Terminal {
+		fmt.Fprintf(w, "- '%d/%d\n", n.Key, n.Value)
+	} else if maxDepth == 0 {
+		fmt.Fprintf(w, "... /%d\n", n.Value)
 	} else {
-		printIndent(indent)
-		fmt.Printf("+ '%d/%d\n", n.Key, n.Value)
-		n.Children[0].print(indent + 2)
-		n.Children[1].print(indent + 2)
+		fmt.Fprintf(w, "+ '%d/%d\n", n.Key, n.Value)
+		n.Children[0].print(w, indent+2, maxDepth-1)
+		n.Children[1].print(w, indent+2, maxDepth-1)
+	}
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
 	}
+	return x
 }
 
-func printIndent(n int) {
+func printIndent(w io.Writer, n int) {
 	for i := 0; i < n; i++ {
-		fmt.Print(" ")
+		fmt.Fprint(w, " ")
 	}
 }
@@ -1,7 +1,12 @@
 package soseg
 
 import (
+	"context"
 	"github.com/magiconair/properties/assert"
+	"math"
+	"math/bits"
+	"math/rand"
+	"sync"
 	"testing"
 )
 
@@ -52,3 +57,1574 @@ func TestTree(t *testing.T) {
 	assert.Equal(t, tree.Total(), 0, "Tree isn't empty")
 	assert.Equal(t, tree.Size(), 0, "Tree isn't empty")
 }
+
+func TestTree_AdjustWeight(t *testing.T) {
+	var tree Tree
+	tree.Put(0, 1)
+	tree.Put(1, 3)
+	tree.Put(2, 4)
+
+	{
+		size, ok := tree.AdjustWeight(1, 2)
+		assert.Equal(t, ok, true, "Could not increase weight")
+		assert.Equal(t, size, 5, "Wrong weight after increase")
+		assert.Equal(t, tree.Total(), 10, "Wrong total amount")
+	}
+
+	{
+		size, ok := tree.AdjustWeight(2, -3)
+		assert.Equal(t, ok, true, "Could not decrease weight")
+		assert.Equal(t, size, 1, "Wrong weight after decrease")
+		assert.Equal(t, tree.Total(), 7, "Wrong total amount")
+		_, offset, _ := tree.Get(2)
+		assert.Equal(t, offset, 6, "Got wrong offset")
+	}
+
+	{
+		size, ok := tree.AdjustWeight(2, -1)
+		assert.Equal(t, ok, false, "Weight dropped to zero")
+		assert.Equal(t, size, 1, "Weight changed by rejected adjustment")
+		assert.Equal(t, tree.Total(), 7, "Wrong total amount")
+	}
+
+	{
+		_, ok := tree.AdjustWeight(3, 1)
+		assert.Equal(t, ok, false, "Adjusted missing key")
+	}
+}
+
+func TestTree_Decrement(t *testing.T) {
+	var tree Tree
+	tree.Put(0, 5)
+	tree.Put(1, 3)
+	{
+		size, removed := tree.Decrement(0, 2)
+		assert.Equal(t, [2]interface{}{size, removed}, [2]interface{}{3, false}, "Wrong decrement")
+		assert.Equal(t, tree.Total(), 6, "Wrong total after decrement")
+	}
+	{
+		size, removed := tree.Decrement(0, 3)
+		assert.Equal(t, [2]interface{}{size, removed}, [2]interface{}{0, true}, "Decrement to zero did not remove")
+		assert.Equal(t, tree.Contains(0), false, "Key still exists")
+	}
+	{
+		size, removed := tree.Decrement(1, 10)
+		assert.Equal(t, [2]interface{}{size, removed}, [2]interface{}{0, true}, "Decrement below zero did not remove")
+		assert.Equal(t, tree.Empty(), true, "Tree not empty")
+	}
+	{
+		size, removed := tree.Decrement(2, 1)
+		assert.Equal(t, [2]interface{}{size, removed}, [2]interface{}{0, false}, "Decremented absent key")
+	}
+}
+
+func TestTree_FindWrap(t *testing.T) {
+	var tree Tree
+	tree.Put(0, 2)
+	tree.Put(1, 3)
+	tree.Put(2, 5)
+
+	for _, c := range []struct {
+		point int
+		key   int
+	}{
+		{0, 0},
+		{4, 1},
+		{9, 2},
+		{10, 0},
+		{2*10 + 3, 1},
+		{-1, 2},
+		{-10, 0},
+		{-7, 1},
+		{math.MinInt, 1},
+		{math.MaxInt, 2},
+	} {
+		key, ok := tree.FindWrap(c.point)
+		assert.Equal(t, ok, true, "Not found in non-empty tree")
+		assert.Equal(t, key, c.key, "Found wrong key")
+	}
+
+	{
+		var empty Tree
+		_, ok := empty.FindWrap(3)
+		assert.Equal(t, ok, false, "Found key in empty tree")
+	}
+}
+
+func TestTree_FindEntry(t *testing.T) {
+	var tree Tree
+	tree.Put(0, 1)
+	tree.Put(1, 3)
+	tree.Put(2, 4)
+	tree.Put(3, 1)
+	tree.Put(4, 2)
+
+	for point := 0; point < tree.Total(); point++ {
+		entry, ok := tree.FindEntry(point)
+		assert.Equal(t, ok, true, "Point inside range not found")
+		key, _ := tree.Find(point)
+		size, offset, _ := tree.Get(key)
+		assert.Equal(t, entry, Entry{Key: key, Size: size, Offset: offset}, "Entry differs from Find+Get")
+	}
+
+	{
+		_, ok := tree.FindEntry(tree.Total())
+		assert.Equal(t, ok, false, "Found point outside range")
+	}
+}
+
+func TestTree_FindBoundary(t *testing.T) {
+	var tree Tree
+	tree.Put(0, 2)
+	tree.Put(1, 3)
+	tree.Put(2, 1)
+	tree.SoftRemove(2)
+	tree.PutRange(3, 4, 2)
+	assert.Equal(t, tree.Contains(2), true, "Soft-removed key not kept")
+
+	// Ranges: 0 [0,2), 1 [2,5), 2 is empty at 5, 3 [5,7), 4 [7,9)
+	for _, c := range []struct {
+		point        int
+		lower, upper int
+		onBoundary   bool
+	}{
+		{0, 0, 0, false},
+		{1, 0, 0, false},
+		{2, 0, 1, true},
+		{3, 1, 1, false},
+		{5, 1, 3, true}, // skips the empty range of key 2
+		{6, 3, 3, false},
+		{7, 3, 4, true},
+		{8, 4, 4, false},
+		{9, 0, 0, false},
+		{-1, 0, 0, false},
+	} {
+		lower, upper, onBoundary := tree.FindBoundary(c.point)
+		assert.Equal(t, [2]int{lower, upper}, [2]int{c.lower, c.upper}, "Wrong keys")
+		assert.Equal(t, onBoundary, c.onBoundary, "Wrong boundary")
+	}
+}
+
+func TestTree_PutReturning(t *testing.T) {
+	var tree Tree
+
+	{
+		old, existed := tree.PutReturning(1, 3)
+		assert.Equal(t, existed, false, "Existed in empty tree")
+		assert.Equal(t, old, 0, "Got old size for new key")
+	}
+
+	{
+		old, existed := tree.PutReturning(2, 4)
+		assert.Equal(t, existed, false, "Existed but was never inserted")
+		assert.Equal(t, old, 0, "Got old size for new key")
+	}
+
+	{
+		old, existed := tree.PutReturning(1, 5)
+		assert.Equal(t, existed, true, "Did not exist but was inserted")
+		assert.Equal(t, old, 3, "Got wrong old size")
+		assert.Equal(t, tree.Total(), 9, "Wrong total amount")
+		assert.Equal(t, tree.Size(), 2, "Wrong number of nodes")
+	}
+
+	assert.Equal(t, tree.Put(3, 1), true, "Put of new key not reported as created")
+	assert.Equal(t, tree.Put(3, 2), false, "Put of existing key reported as created")
+}
+
+func TestTree_PutAfterRemove(t *testing.T) {
+	var tree Tree
+	shadow := make(map[int]int)
+	r := rand.New(rand.NewSource(1))
+
+	for i := 0; i < 20000; i++ {
+		key := r.Intn(500)
+		if r.Intn(3) == 0 {
+			_, present := shadow[key]
+			assert.Equal(t, tree.Remove(key), present, "Remove disagrees with shadow")
+			delete(shadow, key)
+			continue
+		}
+
+		size := r.Intn(100) + 1
+		tree.Put(key, size)
+		shadow[key] = size
+		got, _, ok := tree.Get(key)
+		assert.Equal(t, ok, true, "Not found right after Put")
+		assert.Equal(t, got, size, "Got wrong value right after Put")
+	}
+
+	min, max := 500, -1
+	for key := range shadow {
+		if key < min {
+			min = key
+		}
+		if key > max {
+			max = key
+		}
+	}
+	{
+		gotMin, _ := tree.Min()
+		gotMax, _ := tree.Max()
+		assert.Equal(t, gotMin, min, "Wrong cached min")
+		assert.Equal(t, gotMax, max, "Wrong cached max")
+	}
+
+	total := 0
+	for key, size := range shadow {
+		got, _, ok := tree.Get(key)
+		assert.Equal(t, ok, true, "Not found but inserted")
+		assert.Equal(t, got, size, "Got wrong value")
+		total += size
+	}
+	assert.Equal(t, tree.Size(), len(shadow), "Wrong number of nodes")
+	assert.Equal(t, tree.Total(), total, "Wrong total amount")
+}
+
+func TestTree_Churn(t *testing.T) {
+	for _, alpha := range []float64{0, 0.7} {
+		var tree Tree
+		tree.SetRebuildAlpha(alpha)
+		r := rand.New(rand.NewSource(1))
+		shadow := make(map[int]int)
+		total := 0
+		for i := 0; i < 1e5; i++ {
+			key := r.Intn(1000)
+			old, existed := shadow[key]
+			switch r.Intn(3) {
+			case 0:
+				size := r.Intn(100) + 1
+				tree.Put(key, size)
+				shadow[key] = size
+				total += size - old
+			case 1:
+				assert.Equal(t, tree.Remove(key), existed, "Remove disagrees with shadow")
+				delete(shadow, key)
+				total -= old
+			case 2:
+				delta := r.Intn(101) - 50
+				newSize, ok := tree.AdjustWeight(key, delta)
+				assert.Equal(t, ok, existed && old+delta > 0, "AdjustWeight disagrees with shadow")
+				if ok {
+					shadow[key] = newSize
+					total += delta
+				}
+			}
+			if tree.Size() != len(shadow) || tree.Total() != total {
+				t.Fatalf("op %d: size %d total %d, shadow size %d total %d",
+					i, tree.Size(), tree.Total(), len(shadow), total)
+			}
+		}
+		for key, size := range shadow {
+			got, _, ok := tree.Get(key)
+			assert.Equal(t, ok, true, "Not found but inserted")
+			assert.Equal(t, got, size, "Got wrong value")
+		}
+		assert.Equal(t, tree.Boundaries()[tree.Size()], total, "Wrong sum of ranges")
+
+		// Updates and lookups reuse the existing nodes
+		keys, _ := tree.Columns()
+		allocs := testing.AllocsPerRun(100, func() {
+			key := keys[r.Intn(len(keys))]
+			tree.Put(key, r.Intn(100)+1)
+			tree.AdjustWeight(key, 1)
+			tree.Get(key)
+			tree.Find(r.Intn(tree.Total()))
+		})
+		assert.Equal(t, allocs, 0.0, "Updates allocated")
+
+		// Inserting a key allocates a leaf and a branch at most
+		allocs = testing.AllocsPerRun(100, func() {
+			tree.Put(5000, 1)
+			tree.Remove(5000)
+		})
+		assert.Equal(t, allocs <= 2, true, "Churn allocations not bounded")
+	}
+}
+
+func TestTree_ClearRetain(t *testing.T) {
+	var tree Tree
+	for key := 0; key < 10; key++ {
+		tree.Put(key, key+1)
+	}
+	tree.ClearRetain()
+	assert.Equal(t, tree.Empty(), true, "Tree isn't empty")
+	assert.Equal(t, tree.Total(), 0, "Tree isn't empty")
+
+	allocs := testing.AllocsPerRun(1, func() {
+		for key := 0; key < 10; key++ {
+			tree.Put(key, 2)
+		}
+		tree.ClearRetain()
+	})
+	assert.Equal(t, allocs, 0.0, "Retained nodes were not reused")
+
+	for key := 0; key < 10; key++ {
+		tree.Put(key, 2)
+	}
+	assert.Equal(t, tree.Size(), 10, "Wrong number of nodes")
+	assert.Equal(t, tree.Total(), 20, "Wrong total amount")
+	{
+		val, offset, ok := tree.Get(5)
+		assert.Equal(t, ok, true, "Not found but inserted")
+		assert.Equal(t, val, 2, "Got wrong value")
+		assert.Equal(t, offset, 10, "Got wrong offset")
+	}
+}
+
+func TestTree_FindNearestMidpoint(t *testing.T) {
+	var tree Tree
+	tree.Put(0, 1)
+	tree.Put(1, 10)
+	tree.Put(2, 1)
+
+	for _, c := range []struct {
+		point int
+		key   int
+	}{
+		{-5, 0},
+		{0, 0},
+		{1, 0},
+		{2, 0},
+		{3, 1},
+		{4, 1},
+		{6, 1},
+		{8, 1},
+		{9, 2},
+		{10, 2},
+		{11, 2},
+		{100, 2},
+	} {
+		key, ok := tree.FindNearestMidpoint(c.point)
+		assert.Equal(t, ok, true, "Not found in non-empty tree")
+		assert.Equal(t, key, c.key, "Found wrong key")
+	}
+
+	{
+		var empty Tree
+		_, ok := empty.FindNearestMidpoint(0)
+		assert.Equal(t, ok, false, "Found key in empty tree")
+	}
+}
+
+func TestTree_FindWindow(t *testing.T) {
+	var tree Tree
+	tree.Put(0, 2)
+	tree.Put(1, 3)
+	tree.Put(2, 1)
+	tree.SoftRemove(3)
+	tree.Put(4, 4)
+	assert.Equal(t, tree.PutRange(10, 12, 2), nil, "PutRange failed")
+
+	// Ranges: 0 [0,2), 1 [2,5), 2 [5,6), 4 [6,10), 10 [10,12), 11 [12,14), 12 [14,16)
+	for _, c := range []struct {
+		point, radius int
+		keys          []int
+	}{
+		{0, 0, []int{0}},
+		{3, 1, []int{1}},
+		{4, 1, []int{1, 2}},
+		{5, 1, []int{1, 2, 4}},
+		{8, 3, []int{2, 4, 10}},
+		{12, 1, []int{10, 11}},
+		{13, 1, []int{11, 12}},
+		{-3, 5, []int{0, 1}},
+		{20, 5, []int{12}},
+		{7, 100, []int{0, 1, 2, 4, 10, 11, 12}},
+		{7, math.MaxInt, []int{0, 1, 2, 4, 10, 11, 12}},
+		{-3, 2, nil},
+		{16, 0, nil},
+		{3, -1, nil},
+	} {
+		assert.Equal(t, tree.FindWindow(c.point, c.radius), c.keys, "Wrong keys in window")
+	}
+
+	// The window is exactly covered by the ranges of the returned keys
+	for point := 0; point < tree.Total(); point++ {
+		for radius := 0; radius < 5; radius++ {
+			want := []int(nil)
+			for p := point - radius; p <= point+radius; p++ {
+				if key, ok := tree.Find(p); ok && (len(want) == 0 || want[len(want)-1] != key) {
+					want = append(want, key)
+				}
+			}
+			assert.Equal(t, tree.FindWindow(point, radius), want, "Window not covered by ranges")
+		}
+	}
+
+	assert.Equal(t, new(Tree).FindWindow(0, 1), []int(nil), "Window in empty tree")
+
+	// Key ranges ending at the largest key
+	tree = Tree{}
+	tree.PutRange(math.MaxInt-2, math.MaxInt, 2)
+	assert.Equal(t, tree.FindWindow(4, 1), []int{math.MaxInt - 1, math.MaxInt}, "Wrong keys at largest key")
+	assert.Equal(t, tree.FindWindow(0, 10), []int{math.MaxInt - 2, math.MaxInt - 1, math.MaxInt}, "Wrong keys at largest key")
+}
+
+func TestTree_Clone(t *testing.T) {
+	var tree Tree
+	tree.Put(0, 1)
+	tree.Put(1, 3)
+	tree.Put(2, 4)
+
+	c := tree.Clone()
+	c.Put(1, 5)
+	c.Remove(2)
+
+	assert.Equal(t, tree.Total(), 8, "Original changed by clone")
+	assert.Equal(t, tree.Size(), 3, "Original changed by clone")
+	assert.Equal(t, c.Total(), 6, "Wrong total amount")
+	assert.Equal(t, c.Size(), 2, "Wrong number of nodes")
+}
+
+func TestTree_Columns(t *testing.T) {
+	var tree Tree
+	tree.Put(4, 2)
+	tree.Put(0, 1)
+	tree.Put(3, 1)
+	tree.Put(1, 3)
+	tree.Put(2, 4)
+
+	keys, sizes := tree.Columns()
+	assert.Equal(t, len(keys), tree.Size(), "Wrong number of keys")
+	assert.Equal(t, len(sizes), tree.Size(), "Wrong number of sizes")
+	assert.Equal(t, keys, []int{0, 1, 2, 3, 4}, "Keys not in order")
+	assert.Equal(t, sizes, []int{1, 3, 4, 1, 2}, "Sizes not aligned with keys")
+
+	{
+		var empty Tree
+		keys, sizes := empty.Columns()
+		assert.Equal(t, len(keys), 0, "Got keys from empty tree")
+		assert.Equal(t, len(sizes), 0, "Got sizes from empty tree")
+	}
+}
+
+func TestTree_MinMax(t *testing.T) {
+	var tree Tree
+	{
+		_, ok := tree.Min()
+		assert.Equal(t, ok, false, "Min of empty tree")
+		_, ok = tree.Max()
+		assert.Equal(t, ok, false, "Max of empty tree")
+	}
+
+	tree.Put(3, 1)
+	tree.Put(-2, 1)
+	tree.Put(7, 1)
+	tree.Put(0, 1)
+
+	{
+		min, _ := tree.Min()
+		max, _ := tree.Max()
+		assert.Equal(t, min, -2, "Wrong min")
+		assert.Equal(t, max, 7, "Wrong max")
+	}
+}
+
+func TestTree_Successor(t *testing.T) {
+	var tree Tree
+	{
+		_, ok := tree.Successor(0)
+		assert.Equal(t, ok, false, "Successor in empty tree")
+	}
+	tree.Put(0, 1)
+	tree.Put(5, 2)
+	tree.PutRange(10, 12, 1)
+	tree.Put(20, 3)
+
+	for _, c := range []struct {
+		key, next int
+		ok        bool
+	}{
+		{-5, 0, true},
+		{0, 5, true},
+		{3, 5, true},
+		{5, 10, true},
+		{10, 11, true},
+		{11, 12, true},
+		{12, 20, true},
+		{20, 0, false},
+		{math.MaxInt, 0, false},
+	} {
+		next, ok := tree.Successor(c.key)
+		assert.Equal(t, ok, c.ok, "Wrong successor existence")
+		if c.ok {
+			assert.Equal(t, next, c.next, "Wrong successor")
+		}
+	}
+}
+
+func TestTree_AreAdjacent(t *testing.T) {
+	var tree Tree
+	tree.Put(0, 1)
+	tree.Put(5, 2)
+	tree.PutRange(10, 12, 1)
+
+	assert.Equal(t, tree.AreAdjacent(0, 5), true, "Adjacent keys")
+	assert.Equal(t, tree.AreAdjacent(5, 0), true, "Adjacent keys in reverse")
+	assert.Equal(t, tree.AreAdjacent(5, 10), true, "Adjacent keys before range")
+	assert.Equal(t, tree.AreAdjacent(11, 12), true, "Adjacent keys in range")
+	assert.Equal(t, tree.AreAdjacent(0, 10), false, "Non-adjacent keys")
+	assert.Equal(t, tree.AreAdjacent(10, 12), false, "Non-adjacent keys in range")
+	assert.Equal(t, tree.AreAdjacent(5, 5), false, "Key adjacent to itself")
+	assert.Equal(t, tree.AreAdjacent(0, 3), false, "Absent key")
+	assert.Equal(t, tree.AreAdjacent(13, 12), false, "Absent key after range")
+	tree.Remove(5)
+	assert.Equal(t, tree.AreAdjacent(0, 10), true, "Keys not adjacent after removal")
+}
+
+func TestTree_KeySpan(t *testing.T) {
+	var tree Tree
+	{
+		_, _, ok := tree.KeySpan()
+		assert.Equal(t, ok, false, "Key span of empty tree")
+	}
+	tree.Put(3, 1)
+	tree.Put(-2, 1)
+	tree.Put(9, 1)
+	tree.Remove(9)
+	min, max, ok := tree.KeySpan()
+	assert.Equal(t, ok, true, "No key span of non-empty tree")
+	assert.Equal(t, [2]int{min, max}, [2]int{-2, 3}, "Wrong key span")
+}
+
+func TestTree_Append(t *testing.T) {
+	var tree Tree
+	for i := 0; i < 10; i++ {
+		key, ok := tree.Append(i + 1)
+		assert.Equal(t, ok, true, "Could not append")
+		assert.Equal(t, key, i, "Appended key not consecutive")
+	}
+	assert.Equal(t, tree.Total(), 55, "Wrong total amount")
+	assert.Equal(t, tree.Size(), 10, "Wrong number of nodes")
+
+	tree.Put(20, 1)
+	{
+		key, _ := tree.Append(1)
+		assert.Equal(t, key, 21, "Appended key not after max")
+	}
+
+	tree.Put(math.MaxInt, 1)
+	{
+		_, ok := tree.Append(1)
+		assert.Equal(t, ok, false, "Appended after largest key")
+		assert.Equal(t, tree.Size(), 13, "Failed append changed tree")
+		min, _ := tree.Min()
+		assert.Equal(t, min, 0, "Append wrapped around")
+	}
+}
+
+func TestTree_FindLargeTotal(t *testing.T) {
+	const maxInt = int(^uint(0) >> 1)
+	var tree Tree
+	tree.Put(0, maxInt/2)
+	tree.Put(1, maxInt/4)
+	tree.Put(2, maxInt-maxInt/2-maxInt/4)
+	assert.Equal(t, tree.Total(), maxInt, "Wrong total amount")
+
+	for _, c := range []struct {
+		point int
+		key   int
+	}{
+		{0, 0},
+		{maxInt/2 - 1, 0},
+		{maxInt / 2, 1},
+		{maxInt/2 + maxInt/4, 2},
+		{maxInt - 1, 2},
+	} {
+		key, ok := tree.Find(c.point)
+		assert.Equal(t, ok, true, "Point inside range not found")
+		assert.Equal(t, key, c.key, "Found wrong key")
+	}
+
+	{
+		_, ok := tree.Find(maxInt)
+		assert.Equal(t, ok, false, "Found point outside range")
+	}
+
+	{
+		key, ok := tree.FindNearestMidpoint(-maxInt - 1)
+		assert.Equal(t, ok, true, "Not found in non-empty tree")
+		assert.Equal(t, key, 0, "Found wrong key")
+	}
+}
+
+// Offsets near the largest int must not overflow in deep trees, on any int size
+func TestTree_FindLargeOffsets(t *testing.T) {
+	const maxInt = int(^uint(0) >> 1)
+	const n = 64
+	size := maxInt / n
+	var tree Tree
+	for key := 0; key < n-1; key++ {
+		tree.Put(key, size)
+	}
+	last := maxInt - (n-1)*size
+	tree.Put(n-1, last)
+	assert.Equal(t, tree.Total(), maxInt, "Wrong total amount")
+	assert.Equal(t, tree.Height(), n, "Sorted inserts should build a deep tree")
+
+	for _, c := range []struct {
+		point int
+		key   int
+	}{
+		{maxInt - 1, n - 1},
+		{maxInt - last, n - 1},
+		{maxInt - last - 1, n - 2},
+		{(n - 2) * size, n - 2},
+	} {
+		key, ok := tree.Find(c.point)
+		assert.Equal(t, ok, true, "Point inside range not found")
+		assert.Equal(t, key, c.key, "Found wrong key")
+		e, _ := tree.FindEntry(c.point)
+		assert.Equal(t, e.Key, c.key, "Found wrong entry")
+	}
+	{
+		_, ok := tree.Find(maxInt)
+		assert.Equal(t, ok, false, "Found point outside range")
+		_, offset, _ := tree.Get(n - 1)
+		assert.Equal(t, offset, maxInt-last, "Wrong offset of last key")
+		start, end, _ := tree.Locate(n - 1)
+		assert.Equal(t, [2]int{start, end}, [2]int{maxInt - last, maxInt}, "Wrong range of last key")
+		key, _ := tree.FindWrap(maxInt)
+		assert.Equal(t, key, 0, "Wrong key of wrapped point")
+		assert.Equal(t, tree.FindWindow(maxInt-1, last), []int{n - 2, n - 1}, "Wrong keys in window")
+	}
+}
+
+func TestTree_FindNegativeTotal(t *testing.T) {
+	var tree Tree
+	tree.Put(0, 10)
+	tree.Put(1, 20)
+	tree.Root.Value = -30
+	r := rand.New(rand.NewSource(1))
+	for _, point := range []int{-31, -1, 0, 5, 15, 29} {
+		_, ok := tree.Find(point)
+		assert.Equal(t, ok, false, "Found point in tree with negative total")
+		_, ok = tree.FindEntry(point)
+		assert.Equal(t, ok, false, "Found entry in tree with negative total")
+	}
+	{
+		_, ok := tree.Sample(r)
+		assert.Equal(t, ok, false, "Sampled from tree with negative total")
+	}
+
+	// Weights overflowing the total
+	tree = Tree{}
+	tree.Put(0, math.MaxInt)
+	tree.Put(1, 1)
+	assert.Equal(t, tree.Total() < 0, true, "Total did not overflow")
+	{
+		_, ok := tree.Find(0)
+		assert.Equal(t, ok, false, "Found point in overflowed tree")
+		_, ok = tree.Sample(r)
+		assert.Equal(t, ok, false, "Sampled from overflowed tree")
+	}
+}
+
+func TestTree_NewWithLess(t *testing.T) {
+	tree := NewWithLess(func(a, b int) bool { return a > b })
+	tree.Put(0, 1)
+	tree.Put(1, 3)
+	tree.Put(2, 4)
+	tree.Put(3, 1)
+	tree.Put(4, 2)
+
+	{
+		min, _ := tree.Min()
+		max, _ := tree.Max()
+		assert.Equal(t, min, 4, "Wrong min")
+		assert.Equal(t, max, 0, "Wrong max")
+	}
+
+	{
+		val, offset, ok := tree.Get(2)
+		assert.Equal(t, ok, true, "Not found but inserted")
+		assert.Equal(t, val, 4, "Got wrong value")
+		assert.Equal(t, offset, 3, "Got wrong offset")
+	}
+
+	{
+		key, ok := tree.Find(0)
+		assert.Equal(t, ok, true, "Not found but inserted")
+		assert.Equal(t, key, 4, "Found wrong key")
+	}
+
+	{
+		keys, _ := tree.Columns()
+		assert.Equal(t, keys, []int{4, 3, 2, 1, 0}, "Keys not in reversed order")
+	}
+
+	assert.Equal(t, tree.Remove(4), true, "Could not remove but was inserted")
+	{
+		min, _ := tree.Min()
+		assert.Equal(t, min, 3, "Wrong min after remove")
+		_, offset, _ := tree.Get(0)
+		assert.Equal(t, offset, 8, "Got wrong offset")
+	}
+}
+
+func TestTree_StringDepth(t *testing.T) {
+	var tree Tree
+	for key := 0; key < 5; key++ {
+		tree.Put(key, 1)
+	}
+
+	assert.Equal(t, tree.StringDepth(2), `SoSeg Tree
++ '1/5
+  - '0/1
+  + '2/4
+    - '1/1
+    ... /3
+`, "Wrong truncated output")
+
+	assert.Equal(t, tree.StringDepth(0), "SoSeg Tree\n... /5\n", "Wrong truncated output")
+	assert.Equal(t, tree.StringDepth(-1), tree.StringDepth(4), "Full output truncated")
+
+	var empty Tree
+	assert.Equal(t, empty.StringDepth(1), "SoSeg Tree\n", "Wrong empty output")
+}
+
+func TestNewFromEntries(t *testing.T) {
+	tree, err := NewFromEntries([]Entry{
+		{Key: 0, Size: 1},
+		{Key: 1, Size: 3},
+		{Key: 2, Size: 4},
+		{Key: 3, Size: 1},
+		{Key: 4, Size: 2},
+	})
+	assert.Equal(t, err, nil, "Could not build tree")
+	assert.Equal(t, tree.Total(), 11, "Wrong total amount")
+	assert.Equal(t, tree.Size(), 5, "Wrong number of nodes")
+	{
+		val, offset, ok := tree.Get(2)
+		assert.Equal(t, ok, true, "Not found but inserted")
+		assert.Equal(t, val, 4, "Got wrong value")
+		assert.Equal(t, offset, 4, "Got wrong offset")
+	}
+	{
+		key, _ := tree.Find(10)
+		assert.Equal(t, key, 4, "Found wrong key")
+	}
+
+	tree.Put(5, 1)
+	tree.Remove(0)
+	assert.Equal(t, tree.Total(), 11, "Wrong total amount after update")
+
+	{
+		_, err := NewFromEntries([]Entry{{Key: 1, Size: 1}, {Key: 1, Size: 1}})
+		assert.Equal(t, err != nil, true, "Accepted duplicate keys")
+		_, err = NewFromEntries([]Entry{{Key: 1, Size: 0}})
+		assert.Equal(t, err != nil, true, "Accepted non-positive size")
+	}
+}
+
+func TestNewFromCounts(t *testing.T) {
+	tree, err := NewFromCounts(map[int]int{7: 2, -3: 5, 4: 1})
+	assert.Equal(t, err, nil, "Could not build from counts")
+	assert.Equal(t, tree.Total(), 8, "Wrong total")
+	assert.Equal(t, tree.Size(), 3, "Wrong size")
+	for _, c := range []struct{ key, size, offset int }{{-3, 5, 0}, {4, 1, 5}, {7, 2, 6}} {
+		size, offset, ok := tree.Get(c.key)
+		assert.Equal(t, ok, true, "Counted key not found")
+		assert.Equal(t, [2]int{size, offset}, [2]int{c.size, c.offset}, "Got wrong size or offset")
+	}
+
+	{
+		empty, err := NewFromCounts(nil)
+		assert.Equal(t, err, nil, "Could not build from empty counts")
+		assert.Equal(t, empty.Empty(), true, "Tree from empty counts not empty")
+		_, err = NewFromCounts(map[int]int{1: 1, 2: 0})
+		assert.Equal(t, err != nil, true, "Accepted non-positive count")
+	}
+}
+
+func TestTree_Page(t *testing.T) {
+	tree := BuildRandomTree(100, 1)
+	tree.PutRange(200, 209, 3)
+	tree.Put(math.MinInt, 2)
+	paged, after, more := tree.FirstPage(7)
+	pages := 1
+	for ; more; pages++ {
+		var entries []Entry
+		entries, after, more = tree.Page(after, 7)
+		assert.Equal(t, len(entries) == 7 || !more, true, "Short page before the end")
+		paged = append(paged, entries...)
+	}
+	assert.Equal(t, pages, 16, "Wrong number of pages")
+	assert.Equal(t, paged, tree.Entries(), "Pages do not cover all entries")
+	tree.Remove(math.MinInt)
+
+	{
+		entries, next, more := tree.Page(203, 3)
+		assert.Equal(t, entries, tree.Entries()[104:107], "Wrong page inside key range")
+		assert.Equal(t, next, 206, "Wrong next key")
+		assert.Equal(t, more, true, "No more entries after page")
+	}
+	{
+		entries, next, more := tree.Page(209, 3)
+		assert.Equal(t, len(entries), 0, "Page after last key not empty")
+		assert.Equal(t, next, 209, "Wrong next key after end")
+		assert.Equal(t, more, false, "More entries after end")
+	}
+	{
+		_, _, more := tree.Page(math.MinInt, 0)
+		assert.Equal(t, more, true, "No more entries after empty page")
+	}
+
+	// The first page follows a custom ordering
+	reversed := NewWithLess(func(a, b int) bool { return a > b })
+	for key := 0; key < 5; key++ {
+		reversed.Put(key, key+1)
+	}
+	{
+		entries, next, more := reversed.FirstPage(3)
+		assert.Equal(t, entries, reversed.Entries()[:3], "Wrong first page in custom order")
+		assert.Equal(t, next, 2, "Wrong next key in custom order")
+		assert.Equal(t, more, true, "No more entries in custom order")
+		entries, _, more = reversed.Page(next, 3)
+		assert.Equal(t, entries, reversed.Entries()[3:], "Wrong second page in custom order")
+		assert.Equal(t, more, false, "More entries after end in custom order")
+	}
+	{
+		entries, next, more := new(Tree).FirstPage(3)
+		assert.Equal(t, len(entries), 0, "First page of empty tree not empty")
+		assert.Equal(t, next, 0, "Wrong next key of empty tree")
+		assert.Equal(t, more, false, "More entries in empty tree")
+	}
+}
+
+func TestTree_Entries(t *testing.T) {
+	var tree Tree
+	tree.Put(2, 4)
+	tree.Put(0, 1)
+	tree.Put(1, 3)
+
+	assert.Equal(t, tree.Entries(), []Entry{
+		{Key: 0, Size: 1, Offset: 0},
+		{Key: 1, Size: 3, Offset: 1},
+		{Key: 2, Size: 4, Offset: 4},
+	}, "Wrong entries")
+
+	var empty Tree
+	assert.Equal(t, len(empty.Entries()), 0, "Got entries from empty tree")
+}
+
+func TestTree_Subtree(t *testing.T) {
+	tree := BuildRandomTree(100, 1)
+	sub := tree.Subtree(20, 39)
+
+	var want []Entry
+	var offset int
+	for _, e := range tree.Entries() {
+		if e.Key >= 20 && e.Key <= 39 {
+			want = append(want, Entry{Key: e.Key, Size: e.Size, Offset: offset})
+			offset += e.Size
+		}
+	}
+	assert.Equal(t, sub.Entries(), want, "Wrong subtree entries")
+	assert.Equal(t, sub.Size(), 20, "Wrong number of nodes")
+	assert.Equal(t, sub.Total(), offset, "Wrong total amount")
+
+	total := tree.Total()
+	sub.Put(25, 1000)
+	sub.Remove(30)
+	assert.Equal(t, tree.Total(), total, "Original changed by subtree")
+	assert.Equal(t, tree.Size(), 100, "Original changed by subtree")
+
+	assert.Equal(t, tree.Subtree(200, 300).Empty(), true, "Subtree outside key range not empty")
+}
+
+func TestTree_IsDense(t *testing.T) {
+	var tree Tree
+	assert.Equal(t, tree.IsDense(), false, "Empty tree is dense")
+
+	tree.Put(3, 1)
+	assert.Equal(t, tree.IsDense(), true, "Single key not dense")
+	tree.Put(5, 2)
+	tree.Put(4, 7)
+	assert.Equal(t, tree.IsDense(), true, "Contiguous keys not dense")
+	tree.Put(7, 1)
+	assert.Equal(t, tree.IsDense(), false, "Sparse keys dense")
+	tree.Remove(7)
+	assert.Equal(t, tree.IsDense(), true, "Contiguous keys not dense after remove")
+
+	tree = Tree{}
+	tree.Put(math.MinInt, 1)
+	tree.Put(math.MaxInt, 1)
+	assert.Equal(t, tree.IsDense(), false, "Extreme keys dense")
+	tree = Tree{}
+	tree.Put(math.MaxInt-1, 1)
+	tree.Put(math.MaxInt, 1)
+	assert.Equal(t, tree.IsDense(), true, "Largest keys not dense")
+}
+
+func TestTree_AppendEntries(t *testing.T) {
+	tree := BuildRandomTree(100, 1)
+	assert.Equal(t, tree.AppendEntries(nil), tree.Entries(), "Appended entries differ")
+
+	prefix := []Entry{{Key: -1}}
+	assert.Equal(t, tree.AppendEntries(prefix)[1:], tree.Entries(), "Appended entries differ")
+
+	buf := make([]Entry, 0, tree.Size())
+	allocs := testing.AllocsPerRun(10, func() {
+		buf = tree.AppendEntries(buf[:0])
+	})
+	assert.Equal(t, allocs, 0.0, "Allocated despite sufficient capacity")
+}
+
+func TestTree_PutUpdateDeepLeaf(t *testing.T) {
+	var tree Tree
+	// Ascending inserts build a chain, putting key 9 ten levels deep
+	for key := 0; key < 10; key++ {
+		tree.Put(key, 1)
+	}
+
+	total := tree.Total()
+	for _, size := range []int{5, 2, 17, 1} {
+		old, _, _ := tree.Get(9)
+		tree.Put(9, size)
+		total += size - old
+
+		val, offset, ok := tree.Get(9)
+		assert.Equal(t, ok, true, "Not found but inserted")
+		assert.Equal(t, val, size, "Got wrong value")
+		assert.Equal(t, offset, 9, "Got wrong offset")
+		assert.Equal(t, tree.Total(), total, "Total does not reflect update")
+
+		key, _ := tree.Find(total - 1)
+		assert.Equal(t, key, 9, "Found wrong key")
+	}
+}
+
+func TestTree_Contains(t *testing.T) {
+	var tree Tree
+	assert.Equal(t, tree.Contains(0), false, "Empty tree contains key")
+
+	tree.Put(5, 1)
+	tree.Put(1, 1)
+	tree.Put(9, 1)
+	for _, c := range []struct {
+		key  int
+		want bool
+	}{{0, false}, {1, true}, {4, false}, {5, true}, {9, true}, {10, false}} {
+		assert.Equal(t, tree.Contains(c.key), c.want, "Wrong membership")
+	}
+
+	tree.Remove(9)
+	tree.Remove(1)
+	assert.Equal(t, tree.Contains(9), false, "Contains removed max")
+	{
+		min, _ := tree.Min()
+		max, _ := tree.Max()
+		assert.Equal(t, min, 5, "Wrong min after remove")
+		assert.Equal(t, max, 5, "Wrong max after remove")
+	}
+}
+
+func TestTree_Walk(t *testing.T) {
+	tree := BuildRandomTree(100, 1)
+
+	var branches, leaves, sum int
+	tree.Walk(func(n NodeView, depth int) bool {
+		assert.Equal(t, n.Depth, depth, "Wrong depth in view")
+		if n.IsLeaf {
+			leaves++
+			sum += n.Value
+		} else {
+			branches++
+		}
+		return true
+	})
+	assert.Equal(t, leaves, 100, "Wrong number of leaves")
+	assert.Equal(t, branches, 99, "Wrong number of branches")
+	assert.Equal(t, sum, tree.Total(), "Leaf weights don't add up")
+
+	var visited int
+	tree.Walk(func(n NodeView, depth int) bool {
+		visited++
+		return depth < 1
+	})
+	assert.Equal(t, visited, 3, "Pruned walk visited wrong number of nodes")
+}
+
+func TestTree_RemoveBatch(t *testing.T) {
+	for _, batch := range []int{5, 500} {
+		tree := BuildRandomTree(1000, 1)
+		sizes := make(map[int]int)
+		for _, e := range tree.Entries() {
+			sizes[e.Key] = e.Size
+		}
+
+		var keys []int
+		want := tree.Total()
+		for i := 0; i < batch; i++ {
+			keys = append(keys, i*2)
+			want -= sizes[i*2]
+		}
+		// Absent and repeated keys are ignored
+		keys = append(keys, -1, 5000, 0)
+
+		assert.Equal(t, tree.RemoveBatch(keys), batch, "Wrong number of removed keys")
+		assert.Equal(t, tree.Size(), 1000-batch, "Wrong number of nodes")
+		assert.Equal(t, tree.Total(), want, "Wrong total amount")
+		assert.Equal(t, tree.Contains(0), false, "Found but was removed")
+		assert.Equal(t, tree.Contains(1), true, "Not found but was kept")
+	}
+}
+
+func TestTree_TrimToSize(t *testing.T) {
+	var tree Tree
+	r := rand.New(rand.NewSource(1))
+	for _, key := range r.Perm(100) {
+		tree.Put(key, key+1)
+	}
+	assert.Equal(t, tree.TrimToSize(100), 0, "Trimmed tree within cap")
+	assert.Equal(t, tree.TrimToSize(90), 10, "Wrong number of removed keys")
+	assert.Equal(t, tree.TrimToSize(10), 80, "Wrong number of removed keys")
+	assert.Equal(t, tree.Size(), 10, "Wrong size after trim")
+	keys, _ := tree.Columns()
+	assert.Equal(t, keys, []int{90, 91, 92, 93, 94, 95, 96, 97, 98, 99}, "Wrong survivors")
+	assert.Equal(t, tree.Total(), 91+92+93+94+95+96+97+98+99+100, "Wrong total after trim")
+	{
+		min, _ := tree.Min()
+		assert.Equal(t, min, 90, "Wrong min after trim")
+	}
+
+	// Trims split key ranges
+	tree.PutRange(200, 209, 2)
+	assert.Equal(t, tree.TrimToSize(5), 15, "Wrong number of removed keys")
+	keys, _ = tree.Columns()
+	assert.Equal(t, keys, []int{205, 206, 207, 208, 209}, "Wrong survivors of range")
+	assert.Equal(t, tree.Total(), 10, "Wrong total after range trim")
+	assert.Equal(t, tree.TrimToSize(-1), 5, "Wrong number of removed keys")
+	assert.Equal(t, tree.Empty(), true, "Tree not empty")
+}
+
+func TestTree_RemoveFromTwoLeaves(t *testing.T) {
+	for _, c := range []struct {
+		remove, keep, size int
+	}{{1, 2, 5}, {2, 1, 3}} {
+		var tree Tree
+		tree.Put(1, 3)
+		tree.Put(2, 5)
+
+		assert.Equal(t, tree.Remove(c.remove), true, "Could not remove but was inserted")
+		assert.Equal(t, tree.Root.Terminal, true, "Surviving root isn't a leaf")
+		assert.Equal(t, tree.Root.Parent == nil, true, "Surviving root has a parent")
+		assert.Equal(t, tree.Root.Key, c.keep, "Wrong surviving key")
+		assert.Equal(t, tree.Root.Value, c.size, "Surviving root has stale value")
+		assert.Equal(t, tree.Total(), c.size, "Wrong total amount")
+		assert.Equal(t, tree.Size(), 1, "Wrong number of nodes")
+	}
+}
+
+func TestTree_SwapWeights(t *testing.T) {
+	tree := BuildRandomTree(100, 1)
+	sizeA, _, _ := tree.Get(10)
+	sizeB, _, _ := tree.Get(70)
+	total := tree.Total()
+
+	assert.Equal(t, tree.SwapWeights(10, 70), true, "Could not swap existing keys")
+	{
+		got, _, _ := tree.Get(10)
+		assert.Equal(t, got, sizeB, "Wrong weight after swap")
+		got, _, _ = tree.Get(70)
+		assert.Equal(t, got, sizeA, "Wrong weight after swap")
+	}
+	assert.Equal(t, tree.Total(), total, "Total changed by swap")
+
+	var offset int
+	for _, e := range tree.Entries() {
+		_, got, _ := tree.Get(e.Key)
+		assert.Equal(t, got, offset, "Got wrong offset after swap")
+		offset += e.Size
+	}
+
+	assert.Equal(t, tree.SwapWeights(10, 500), false, "Swapped with absent key")
+	{
+		got, _, _ := tree.Get(10)
+		assert.Equal(t, got, sizeB, "Weight changed by failed swap")
+	}
+}
+
+func TestTree_ForEachByWeight(t *testing.T) {
+	var tree Tree
+	tree.Put(0, 3)
+	tree.Put(1, 1)
+	tree.Put(2, 4)
+	tree.Put(3, 1)
+	tree.Put(4, 5)
+
+	collect := func(descending bool, limit int) (keys []int) {
+		tree.ForEachByWeight(descending, func(key, size int) bool {
+			keys = append(keys, key)
+			return len(keys) < limit
+		})
+		return
+	}
+	assert.Equal(t, collect(false, 10), []int{1, 3, 0, 2, 4}, "Wrong ascending order")
+	assert.Equal(t, collect(true, 10), []int{4, 2, 0, 1, 3}, "Wrong descending order")
+	assert.Equal(t, collect(true, 2), []int{4, 2}, "Iteration did not stop")
+}
+
+func TestTree_Boundaries(t *testing.T) {
+	tree := BuildRandomTree(100, 1)
+	b := tree.Boundaries()
+	assert.Equal(t, len(b), tree.Size()+1, "Wrong number of boundaries")
+	assert.Equal(t, b[0], 0, "Boundaries don't start at 0")
+	assert.Equal(t, b[len(b)-1], tree.Total(), "Boundaries don't end at total")
+	for i, e := range tree.Entries() {
+		assert.Equal(t, b[i+1]-b[i], e.Size, "Boundary gap differs from weight")
+	}
+
+	var empty Tree
+	assert.Equal(t, empty.Boundaries(), []int{0}, "Wrong boundaries of empty tree")
+}
+
+func TestTree_SoftRemove(t *testing.T) {
+	tree := BuildRandomTree(100, 1)
+	for key := 0; key < 100; key += 3 {
+		assert.Equal(t, tree.SoftRemove(key), true, "Could not soft remove but was inserted")
+	}
+	assert.Equal(t, tree.SoftRemove(100), false, "Soft removed absent key")
+	assert.Equal(t, tree.Size(), 100, "Soft remove changed the number of nodes")
+
+	for point := 0; point < tree.Total(); point++ {
+		key, ok := tree.Find(point)
+		assert.Equal(t, ok, true, "Point inside range not found")
+		assert.Equal(t, key%3 != 0, true, "Found tombstoned key")
+	}
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 1000; i++ {
+		key, _ := tree.Sample(r)
+		assert.Equal(t, key%3 != 0, true, "Sampled tombstoned key")
+	}
+
+	entries := tree.Entries()
+	total := tree.Total()
+	assert.Equal(t, tree.Compact(), 34, "Wrong number of compacted nodes")
+	assert.Equal(t, tree.Size(), 66, "Wrong number of nodes")
+	assert.Equal(t, tree.Total(), total, "Compact changed the total")
+	assert.Equal(t, tree.Contains(0), false, "Found but was compacted")
+	{
+		var offset int
+		for _, e := range entries {
+			if e.Size == 0 {
+				continue
+			}
+			size, got, ok := tree.Get(e.Key)
+			assert.Equal(t, ok, true, "Not found after compact")
+			assert.Equal(t, size, e.Size, "Got wrong value after compact")
+			assert.Equal(t, got, offset, "Got wrong offset after compact")
+			offset += e.Size
+		}
+	}
+	assert.Equal(t, tree.Compact(), 0, "Compacted clean tree")
+}
+
+func TestTree_FindTrace(t *testing.T) {
+	var tree Tree
+	tree.Put(5, 1)
+	{
+		key, path, ok := tree.FindTrace(0)
+		assert.Equal(t, ok, true, "Point inside range not found")
+		assert.Equal(t, key, 5, "Found wrong key")
+		assert.Equal(t, len(path), 0, "Path of single leaf not empty")
+	}
+
+	// Builds the branches '3 -> ('1 -> 0, 1), ('4 -> 3, 4)
+	built, _ := NewFromEntries([]Entry{{0, 1, 0}, {1, 3, 0}, {3, 4, 0}, {4, 1, 0}})
+	for _, c := range []struct {
+		point int
+		key   int
+		path  []int
+	}{
+		{0, 0, []int{3, 1}},
+		{3, 1, []int{3, 1}},
+		{4, 3, []int{3, 4}},
+		{8, 4, []int{3, 4}},
+	} {
+		key, path, ok := built.FindTrace(c.point)
+		assert.Equal(t, ok, true, "Point inside range not found")
+		assert.Equal(t, key, c.key, "Found wrong key")
+		assert.Equal(t, path, c.path, "Wrong path")
+	}
+	{
+		_, _, ok := built.FindTrace(9)
+		assert.Equal(t, ok, false, "Found point outside range")
+	}
+}
+
+// cancelAfter is a context that is canceled once Err was called n times.
+type cancelAfter struct {
+	context.Context
+	n int
+}
+
+func (c *cancelAfter) Err() error {
+	if c.n--; c.n < 0 {
+		return context.Canceled
+	}
+	return nil
+}
+
+func TestTree_RebuildContext(t *testing.T) {
+	var tree Tree
+	for key := 0; key < 10000; key++ {
+		tree.Put(key, key%7+1)
+	}
+	want := tree.Entries()
+	height := tree.Height()
+
+	for _, n := range []int{0, 3} {
+		err := tree.RebuildContext(&cancelAfter{Context: context.Background(), n: n})
+		assert.Equal(t, err, context.Canceled, "Rebuild not canceled")
+		assert.Equal(t, tree.Height(), height, "Canceled rebuild changed tree")
+		assert.Equal(t, tree.Entries(), want, "Canceled rebuild changed entries")
+	}
+
+	assert.Equal(t, tree.RebuildContext(context.Background()), nil, "Rebuild failed")
+	assert.Equal(t, tree.Height(), 15, "Tree not rebuilt")
+	assert.Equal(t, tree.Entries(), want, "Rebuild changed entries")
+}
+
+func TestTree_Height(t *testing.T) {
+	var tree Tree
+	assert.Equal(t, tree.Height(), 0, "Wrong height of empty tree")
+	tree.Put(0, 1)
+	assert.Equal(t, tree.Height(), 1, "Wrong height of single leaf")
+	for key := 1; key < 8; key++ {
+		tree.Put(key, 1)
+	}
+	assert.Equal(t, tree.Height(), 8, "Wrong height of chain")
+
+	tree.Rebuild()
+	assert.Equal(t, tree.Height(), 4, "Wrong height after rebuild")
+	assert.Equal(t, tree.Size(), 8, "Rebuild changed the number of nodes")
+	assert.Equal(t, tree.Total(), 8, "Rebuild changed the total")
+}
+
+func TestTree_SetMaxHeightFactor(t *testing.T) {
+	var tree Tree
+	tree.SetMaxHeightFactor(2)
+	for key := 0; key < 10000; key++ {
+		tree.Put(key, 1)
+		if key%100 != 0 {
+			continue
+		}
+		if bound := 2 * (bits.Len(uint(tree.Size()-1)) + 1); tree.Height() > bound {
+			t.Fatalf("Height %d exceeds %d at size %d", tree.Height(), bound, tree.Size())
+		}
+	}
+	assert.Equal(t, tree.Total(), 10000, "Wrong total amount")
+	{
+		_, offset, _ := tree.Get(5000)
+		assert.Equal(t, offset, 5000, "Got wrong offset")
+	}
+
+	// Removals check the bound of the remaining tree
+	tree = Tree{}
+	for key := 0; key < 64; key++ {
+		tree.Put(key, 1)
+	}
+	tree.SetMaxHeightFactor(3)
+	assert.Equal(t, tree.Height(), 64, "Unbounded tree rebuilt")
+	tree.Remove(32)
+	assert.Equal(t, tree.Height(), 7, "Removal did not rebuild")
+	assert.Equal(t, tree.Size(), 63, "Wrong number of nodes")
+
+	// Factors close to 1 still leave slack above a balanced tree
+	for _, f := range []float64{1.01, 1.5} {
+		entries := make([]Entry, 2049)
+		for i := range entries {
+			entries[i] = Entry{Key: 2 * i, Size: 1}
+		}
+		tree, _ := NewFromEntries(entries)
+		tree.SetMaxHeightFactor(f)
+		r := rand.New(rand.NewSource(1))
+		rebuilds := 0
+		for i := 0; i < 2000; i++ {
+			root := tree.Root
+			key := r.Intn(4 * len(entries))
+			if r.Intn(2) == 0 {
+				tree.Put(key, 1)
+			} else {
+				tree.Remove(key)
+			}
+			if tree.Root != root {
+				rebuilds++
+			}
+		}
+		if rebuilds > 50 {
+			t.Fatalf("%d rebuilds in 2000 operations with factor %v", rebuilds, f)
+		}
+	}
+
+	// Factors without slack disable rebuilds
+	tree = Tree{}
+	tree.SetMaxHeightFactor(1)
+	for key := 0; key < 64; key++ {
+		tree.Put(key, 1)
+	}
+	assert.Equal(t, tree.Height(), 64, "Factor of 1 rebuilt")
+}
+
+func TestTree_MergeFunc(t *testing.T) {
+	build := func() (*Tree, *Tree) {
+		var a, b Tree
+		a.Put(0, 1)
+		a.Put(1, 3)
+		a.Put(2, 4)
+		b.Put(1, 5)
+		b.Put(2, 2)
+		b.Put(3, 7)
+		return &a, &b
+	}
+
+	{
+		a, b := build()
+		a.MergeFunc(b, func(key, x, y int) int { return x + y })
+		_, sizes := a.Columns()
+		assert.Equal(t, sizes, []int{1, 8, 6, 7}, "Wrong summed weights")
+		assert.Equal(t, a.Total(), 22, "Wrong total amount")
+		assert.Equal(t, b.Total(), 14, "Merged tree changed")
+	}
+
+	{
+		a, b := build()
+		a.MergeFunc(b, func(key, x, y int) int {
+			if x > y {
+				return x
+			}
+			return y
+		})
+		_, sizes := a.Columns()
+		assert.Equal(t, sizes, []int{1, 5, 4, 7}, "Wrong max weights")
+		assert.Equal(t, a.Total(), 17, "Wrong total amount")
+	}
+
+	{
+		a, b := build()
+		a.MergeFunc(b, func(key, x, y int) int { return x - y })
+		keys, sizes := a.Columns()
+		assert.Equal(t, keys, []int{0, 2, 3}, "Key with non-positive weight kept")
+		assert.Equal(t, sizes, []int{1, 2, 7}, "Wrong resolved weights")
+		assert.Equal(t, a.Total(), 10, "Wrong total amount")
+	}
+
+	// Soft-removed keys only in other are not merged
+	{
+		a, b := build()
+		b.SoftRemove(3)
+		a.MergeFunc(b, func(key, x, y int) int { return x + y })
+		keys, sizes := a.Columns()
+		assert.Equal(t, keys, []int{0, 1, 2}, "Soft-removed key merged")
+		assert.Equal(t, sizes, []int{1, 8, 6}, "Wrong summed weights")
+		assert.Equal(t, len(a.DeadKeys()), 0, "Merge created dead keys")
+	}
+}
+
+func TestTree_SafeGet(t *testing.T) {
+	tree := BuildRandomTree(100, 1)
+	for key := 0; key < 100; key++ {
+		wantSize, wantOffset, _ := tree.Get(key)
+		size, offset, err := tree.SafeGet(key)
+		assert.Equal(t, err, nil, "Error on valid tree")
+		assert.Equal(t, size, wantSize, "Got wrong value")
+		assert.Equal(t, offset, wantOffset, "Got wrong offset")
+	}
+	{
+		_, _, err := tree.SafeGet(100)
+		assert.Equal(t, err != nil, true, "Found missing key")
+	}
+
+	{
+		broken := tree.Clone()
+		broken.Root.Children[1] = nil
+		_, _, err := broken.SafeGet(99)
+		assert.Equal(t, err != nil, true, "Missing child not detected")
+	}
+	{
+		broken := tree.Clone()
+		broken.Root.Value++
+		_, _, err := broken.SafeGet(0)
+		assert.Equal(t, err != nil, true, "Wrong sum not detected")
+	}
+	{
+		var empty Tree
+		_, _, err := empty.SafeGet(0)
+		assert.Equal(t, err != nil, true, "Found key in empty tree")
+	}
+}
+
+func TestTree_Rename(t *testing.T) {
+	var tree Tree
+	tree.Put(0, 1)
+	tree.Put(1, 3)
+	tree.Put(2, 4)
+
+	assert.Equal(t, tree.Rename(1, 10), nil, "Could not rename")
+	assert.Equal(t, tree.Total(), 8, "Total changed by rename")
+	assert.Equal(t, tree.Contains(1), false, "Old key still present")
+	{
+		size, offset, ok := tree.Get(10)
+		assert.Equal(t, ok, true, "New key not found")
+		assert.Equal(t, size, 3, "Got wrong value")
+		assert.Equal(t, offset, 5, "Got wrong offset")
+	}
+
+	assert.Equal(t, tree.Rename(1, 11) != nil, true, "Renamed missing key")
+	assert.Equal(t, tree.Rename(0, 2) != nil, true, "Renamed onto existing key")
+	assert.Equal(t, tree.Rename(2, 2), nil, "Could not rename key to itself")
+	assert.Equal(t, tree.Size(), 3, "Wrong number of nodes")
+	assert.Equal(t, tree.Total(), 8, "Total changed by failed rename")
+
+	// A rename is a single mutation, in place or across other keys
+	tree = *BuildRandomTree(100, 1)
+	tree.PutRange(1000, 1009, 2)
+	tree.EnableChangelog()
+	for _, c := range [][2]int{{99, 500}, {1005, 1020}, {0, -5}, {1009, 999}, {20, 5000}, {5000, 1005}} {
+		want := make(map[int]int)
+		tree.each(func(key, size int) bool {
+			want[key] = size
+			return true
+		})
+		want[c[1]] = want[c[0]]
+		delete(want, c[0])
+		version := tree.Version()
+
+		assert.Equal(t, tree.Rename(c[0], c[1]), nil, "Could not rename")
+		assert.Equal(t, tree.Version(), version+1, "Rename not counted once")
+		assert.Equal(t, tree.DrainChangelog(), []Op{{Kind: OpRename, Key: c[0], Last: c[1], Size: want[c[1]]}}, "Wrong changelog")
+		got := make(map[int]int)
+		tree.each(func(key, size int) bool {
+			got[key] = size
+			return true
+		})
+		assert.Equal(t, got, want, "Wrong entries after rename")
+		for key := range want {
+			_, _, ok := tree.Get(key)
+			assert.Equal(t, ok, true, "Key not found after rename")
+		}
+		min, max, _ := tree.KeySpan()
+		keys, _ := tree.Columns()
+		assert.Equal(t, [2]int{min, max}, [2]int{keys[0], keys[len(keys)-1]}, "Wrong bounds after rename")
+	}
+}
+
+func TestTree_SumBelow(t *testing.T) {
+	var tree Tree
+	assert.Equal(t, tree.SumBelow(5), 0, "Sum in empty tree")
+	for _, key := range []int{10, 0, 30, 20, 40} {
+		tree.Put(key, key+1)
+	}
+	tree.PutRange(50, 59, 2)
+	for _, e := range tree.Entries() {
+		assert.Equal(t, tree.SumBelow(e.Key), e.Offset, "Sum differs from offset of present key")
+	}
+	for _, c := range []struct{ key, sum int }{
+		{-5, 0}, {5, 1}, {15, 12}, {25, 33}, {45, 105}, {100, 125},
+	} {
+		assert.Equal(t, tree.SumBelow(c.key), c.sum, "Wrong sum below absent key")
+	}
+}
+
+func TestTree_Locate(t *testing.T) {
+	tree := BuildRandomTree(50, 1)
+	var covered int
+	for key := 0; key < 50; key++ {
+		start, end, ok := tree.Locate(key)
+		assert.Equal(t, ok, true, "Not found but inserted")
+		for point := start; point < end; point++ {
+			found, _ := tree.Find(point)
+			assert.Equal(t, found, key, "Find disagrees with Locate")
+		}
+		covered += end - start
+	}
+	assert.Equal(t, covered, tree.Total(), "Ranges don't cover the total")
+
+	{
+		_, _, ok := tree.Locate(50)
+		assert.Equal(t, ok, false, "Located missing key")
+	}
+}
+
+func TestTree_Equal(t *testing.T) {
+	var a, b Tree
+	assert.Equal(t, a.Equal(&b), true, "Empty trees differ")
+
+	a.Put(0, 1)
+	a.Put(1, 3)
+	b.Put(1, 3)
+	assert.Equal(t, a.Equal(&b), false, "Trees with different keys equal")
+	b.Put(0, 2)
+	assert.Equal(t, a.Equal(&b), false, "Trees with different weights equal")
+	b.Put(0, 1)
+	assert.Equal(t, a.Equal(&b), true, "Trees with same entries differ")
+}
+
+func TestTree_StructurallyEqual(t *testing.T) {
+	var a, b Tree
+	assert.Equal(t, a.StructurallyEqual(&b), true, "Empty trees differ")
+	for key := 0; key < 8; key++ {
+		a.Put(key, key+1)
+	}
+	assert.Equal(t, a.StructurallyEqual(&b), false, "Empty tree equals non-empty tree")
+
+	b.MergeFunc(&a, nil)
+	assert.Equal(t, a.Equal(&b), true, "Trees with same entries differ")
+	assert.Equal(t, a.StructurallyEqual(&b), true, "Same insertion order yields different shapes")
+
+	b.Rebuild()
+	assert.Equal(t, a.Equal(&b), true, "Rebuild changed entries")
+	assert.Equal(t, a.StructurallyEqual(&b), false, "Chain equals balanced tree")
+	balanced, _ := NewFromEntries(a.Entries())
+	assert.Equal(t, b.StructurallyEqual(balanced), true, "Balanced builds differ")
+}
+
+func TestTree_FindIndependentOfShape(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	var ascending, descending Tree
+	for key := 0; key < 100; key++ {
+		ascending.Put(key, r.Intn(5)+1)
+	}
+	entries := ascending.Entries()
+	for i := len(entries) - 1; i >= 0; i-- {
+		descending.Put(entries[i].Key, entries[i].Size)
+	}
+	var random Tree
+	for _, i := range r.Perm(len(entries)) {
+		random.Put(entries[i].Key, entries[i].Size)
+	}
+
+	assert.Equal(t, ascending.Equal(&descending), true, "Trees not equal")
+	assert.Equal(t, ascending.Equal(&random), true, "Trees not equal")
+	for point := 0; point < ascending.Total(); point++ {
+		want, _ := ascending.Find(point)
+		got, _ := descending.Find(point)
+		assert.Equal(t, got, want, "Find depends on insertion order")
+		got, _ = random.Find(point)
+		assert.Equal(t, got, want, "Find depends on insertion order")
+	}
+}
+
+func TestTree_Warm(t *testing.T) {
+	for _, n := range []int{0, 1, 2, 1000} {
+		tree := BuildRandomTree(n, 1)
+		total := tree.Total()
+		tree.Warm()
+		assert.Equal(t, tree.Total(), total, "Warm changed the tree")
+		assert.Equal(t, tree.Size(), n, "Warm changed the tree")
+	}
+
+	// Concurrent warming of separate trees shares no state
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			BuildRandomTree(100, 1).Warm()
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,274 @@
+package soseg
+
+import (
+	"math"
+	"math/bits"
+)
+
+// WeightRange returns the smallest and largest leaf weights in O(n).
+func (t *Tree) WeightRange() (min, max int, ok bool) {
+	t.each(func(_, size int) bool {
+		if !ok || size < min {
+			min = size
+		}
+		if !ok || size > max {
+			max = size
+		}
+		ok = true
+		return true
+	})
+	return
+}
+
+// WeightStdDev returns the population standard deviation of the leaf weights
+// in a single O(n) pass, accumulating with Welford's algorithm to stay stable
+// for large weights with little spread.
+func (t *Tree) WeightStdDev() (stddev float64, ok bool) {
+	var count int
+	var mean, m2 float64
+	t.each(func(_, size int) bool {
+		count++
+		delta := float64(size) - mean
+		mean += delta / float64(count)
+		m2 += delta * (float64(size) - mean)
+		return true
+	})
+	if count == 0 {
+		return 0, false
+	}
+	return math.Sqrt(m2 / float64(count)), true
+}
+
+// Resolution returns the smallest selection probability that
+// a single weight unit can represent, which is 1/Total().
+// It returns 0 for an empty tree.
+func (t *Tree) Resolution() float64 {
+	total := t.Total()
+	if total <= 0 {
+		return 0
+	}
+	return 1 / float64(total)
+}
+
+// LongestRun returns the first key and the length of the longest run
+// of consecutive integer keys in O(n). The earliest run wins ties.
+// It assumes the native key ordering and returns (0, 0) for an empty tree.
+func (t *Tree) LongestRun() (start, length int) {
+	var runStart, runLength, prev int
+	t.each(func(key, _ int) bool {
+		if runLength > 0 && key == prev+1 {
+			runLength++
+		} else {
+			runStart, runLength = key, 1
+		}
+		if runLength > length {
+			start, length = runStart, runLength
+		}
+		prev = key
+		return true
+	})
+	return
+}
+
+// WeightedMedianKey returns the key whose range contains the point Total()/2.
+func (t *Tree) WeightedMedianKey() (key int, ok bool) {
+	return t.Find(t.Total() / 2)
+}
+
+// WeightedMeanKey returns the mean of the keys weighted by their weights in O(n),
+// which is the expected value of Sample.
+func (t *Tree) WeightedMeanKey() (mean float64, ok bool) {
+	total := float64(t.Total())
+	if total <= 0 {
+		return 0, false
+	}
+	t.each(func(key, size int) bool {
+		mean += float64(key) * float64(size) / total
+		return true
+	})
+	return mean, true
+}
+
+// Entropy returns the Shannon entropy in bits of the normalized weight distribution in O(n).
+// It returns 0 for empty and single-key trees.
+func (t *Tree) Entropy() float64 {
+	total := float64(t.Total())
+	var h float64
+	t.each(func(_, size int) bool {
+		if p := float64(size) / total; p > 0 {
+			h -= p * math.Log2(p)
+		}
+		return true
+	})
+	return h
+}
+
+// Coverage returns the weight covered by leaves and the weight of gaps,
+// which is the part of [0, Total()) not covered by any leaf.
+// Ranges always tile the total without gaps, so a non-zero gap
+// means that the branch sums have been corrupted.
+func (t *Tree) Coverage() (covered int, gaps int) {
+	t.leaves(func(n *Node) bool {
+		covered += n.Value
+		return true
+	})
+	return covered, t.Total() - covered
+}
+
+// DeadKeys returns the keys with weights <= 0 in key order.
+// Their ranges are empty, so Find and Sample can never return them.
+// Apart from keys tombstoned by SoftRemove, they indicate corrupted weights.
+func (t *Tree) DeadKeys() []int {
+	keys := []int{}
+	t.each(func(key, size int) bool {
+		if size <= 0 {
+			keys = append(keys, key)
+		}
+		return true
+	})
+	return keys
+}
+
+// WeightHistogram counts the keys per weight bucket, splitting the range
+// between the smallest and largest weight into equal-width buckets.
+// It returns nil for an empty tree, a tree whose weights are all equal
+// or a non-positive number of buckets.
+func (t *Tree) WeightHistogram(buckets int) []int {
+	min, max, ok := t.WeightRange()
+	if !ok || min == max || buckets <= 0 {
+		return nil
+	}
+	counts := make([]int, buckets)
+	width := float64(max-min) / float64(buckets)
+	t.each(func(_, size int) bool {
+		i := int(float64(size-min) / width)
+		if i >= buckets {
+			// The largest weight closes the last bucket
+			i = buckets - 1
+		}
+		counts[i]++
+		return true
+	})
+	return counts
+}
+
+// ExpectedCoverageDraws returns the expected number of weighted draws
+// with replacement until every key has been drawn at least once,
+// which is the weighted coupon collector's problem.
+// It numerically integrates E = ∫ 1 - Π(1 - exp(-p_i·t)) dt over a fixed grid
+// in O(n) and returns 0 for an empty tree.
+// Keys with zero weight can never be drawn, so they are not counted.
+func (t *Tree) ExpectedCoverageDraws() float64 {
+	total := float64(t.Total())
+	if total <= 0 {
+		return 0
+	}
+	probs := make([]float64, 0, t.size)
+	minProb := 1.0
+	t.each(func(_, size int) bool {
+		if size > 0 {
+			p := float64(size) / total
+			probs = append(probs, p)
+			minProb = math.Min(minProb, p)
+		}
+		return true
+	})
+	if len(probs) <= 1 {
+		return float64(len(probs))
+	}
+
+	// Beyond tMax the integrand is below exp(-40)/n per key
+	f := func(x float64) float64 {
+		var logMissing float64
+		for _, p := range probs {
+			logMissing += math.Log1p(-math.Exp(-p * x))
+		}
+		return -math.Expm1(logMissing)
+	}
+	const steps = 1 << 12
+	tMax := (math.Log(float64(len(probs))) + 40) / minProb
+	h := tMax / steps
+	sum := f(0) + f(tMax)
+	for i := 1; i < steps; i++ {
+		if i%2 == 1 {
+			sum += 4 * f(float64(i)*h)
+		} else {
+			sum += 2 * f(float64(i)*h)
+		}
+	}
+	return sum * h / 3
+}
+
+// Balance returns the ratio of the smallest possible height for the number of leaves,
+// ceil(log2(leaves))+1, to the actual Height() in O(n).
+// A key range added by PutRange counts as a single leaf.
+// A perfectly balanced tree scores 1 and degenerate shapes approach 0.
+// Empty and single-leaf trees score 1.
+func (t *Tree) Balance() float64 {
+	leaves := 0
+	t.leaves(func(*Node) bool {
+		leaves++
+		return true
+	})
+	if leaves <= 1 {
+		return 1
+	}
+	optimal := bits.Len(uint(leaves-1)) + 1
+	return float64(optimal) / float64(t.Height())
+}
+
+// KeysAbove returns the keys with weights greater than threshold in key order.
+func (t *Tree) KeysAbove(threshold int) []int {
+	keys := []int{}
+	t.each(func(key, size int) bool {
+		if size > threshold {
+			keys = append(keys, key)
+		}
+		return true
+	})
+	return keys
+}
+
+// WeightToReach returns the weight a new key needs for Total() to reach target,
+// or 0 if the total already reaches it.
+func (t *Tree) WeightToReach(target int) int {
+	if total := t.Total(); total < target {
+		return target - total
+	}
+	return 0
+}
+
+// HeavyHitters returns the fewest keys whose combined weight reaches fraction*Total(),
+// heaviest first with ties in key order, in O(n log n).
+// It returns nil for an empty tree or a fraction outside (0, 1].
+func (t *Tree) HeavyHitters(fraction float64) []int {
+	if !(fraction > 0 && fraction <= 1) || t.Total() <= 0 {
+		return nil
+	}
+	target := fraction * float64(t.Total())
+	var keys []int
+	sum := 0
+	t.ForEachByWeight(true, func(key, size int) bool {
+		keys = append(keys, key)
+		sum += size
+		return float64(sum) < target
+	})
+	return keys
+}
+
+// MaxShare returns the heaviest key, the first one in key order on a tie,
+// and its weight as a fraction of Total() in O(n).
+func (t *Tree) MaxShare() (key int, share float64, ok bool) {
+	total := t.Total()
+	if total <= 0 {
+		return 0, 0, false
+	}
+	max := 0
+	t.each(func(k, size int) bool {
+		if !ok || size > max {
+			key, max, ok = k, size, true
+		}
+		return true
+	})
+	return key, float64(max) / float64(total), true
+}
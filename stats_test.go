@@ -0,0 +1,273 @@
+package soseg
+
+import (
+	"github.com/magiconair/properties/assert"
+	"math"
+	"testing"
+)
+
+func TestTree_WeightRange(t *testing.T) {
+	var tree Tree
+	{
+		_, _, ok := tree.WeightRange()
+		assert.Equal(t, ok, false, "Weight range of empty tree")
+	}
+
+	tree.Put(0, 7)
+	tree.Put(1, 3)
+	tree.Put(2, 250)
+	tree.Put(3, 1)
+	tree.Put(4, 12)
+
+	min, max, ok := tree.WeightRange()
+	assert.Equal(t, ok, true, "No weight range for non-empty tree")
+	assert.Equal(t, min, 1, "Wrong min weight")
+	assert.Equal(t, max, 250, "Wrong max weight")
+}
+
+func TestTree_WeightStdDev(t *testing.T) {
+	var tree Tree
+	{
+		_, ok := tree.WeightStdDev()
+		assert.Equal(t, ok, false, "Standard deviation of empty tree")
+	}
+
+	// Mean 5, squared deviations 9, 1, 1, 1, 0, 0, 4, 16
+	for key, size := range []int{2, 4, 4, 4, 5, 5, 7, 9} {
+		tree.Put(key, size)
+	}
+	stddev, ok := tree.WeightStdDev()
+	assert.Equal(t, ok, true, "No standard deviation for non-empty tree")
+	assert.Equal(t, stddev, 2.0, "Wrong standard deviation")
+
+	// Large weights with little spread
+	tree = Tree{}
+	tree.PutRange(0, 9, 1<<40)
+	tree.Put(10, 1<<40+11)
+	stddev, _ = tree.WeightStdDev()
+	assert.Equal(t, math.Abs(stddev-math.Sqrt(10)) < 1e-6, true, "Unstable standard deviation")
+}
+
+func TestTree_Resolution(t *testing.T) {
+	var tree Tree
+	assert.Equal(t, tree.Resolution(), 0.0, "Resolution of empty tree")
+
+	tree.Put(0, 30)
+	tree.Put(1, 10)
+	assert.Equal(t, tree.Resolution(), 0.025, "Wrong resolution")
+}
+
+func TestTree_LongestRun(t *testing.T) {
+	var tree Tree
+	{
+		start, length := tree.LongestRun()
+		assert.Equal(t, start, 0, "Run start in empty tree")
+		assert.Equal(t, length, 0, "Run length in empty tree")
+	}
+
+	for _, key := range []int{-3, -2, 0, 1, 2, 3, 7, 10, 11, 12, 13, 20} {
+		tree.Put(key, 1)
+	}
+	start, length := tree.LongestRun()
+	assert.Equal(t, start, 0, "Wrong run start")
+	assert.Equal(t, length, 4, "Wrong run length")
+
+	tree.Put(14, 1)
+	start, length = tree.LongestRun()
+	assert.Equal(t, start, 10, "Wrong run start")
+	assert.Equal(t, length, 5, "Wrong run length")
+}
+
+func TestTree_WeightedMedianKey(t *testing.T) {
+	var tree Tree
+	{
+		_, ok := tree.WeightedMedianKey()
+		assert.Equal(t, ok, false, "Median of empty tree")
+	}
+
+	tree.Put(0, 1)
+	tree.Put(1, 1)
+	tree.Put(2, 1)
+	tree.Put(1000, 10)
+	key, ok := tree.WeightedMedianKey()
+	want, _ := tree.Find(tree.Total() / 2)
+	assert.Equal(t, ok, true, "No median for non-empty tree")
+	assert.Equal(t, key, want, "Median differs from Find")
+	assert.Equal(t, key, 1000, "Wrong median")
+}
+
+func TestTree_Entropy(t *testing.T) {
+	var tree Tree
+	assert.Equal(t, tree.Entropy(), 0.0, "Entropy of empty tree")
+	tree.Put(0, 5)
+	assert.Equal(t, tree.Entropy(), 0.0, "Entropy of single key")
+
+	for key := 1; key < 16; key++ {
+		tree.Put(key, 5)
+	}
+	if math.Abs(tree.Entropy()-4) > 1e-9 {
+		t.Fatalf("Uniform entropy is %f, want 4", tree.Entropy())
+	}
+
+	tree.Put(0, 1000000)
+	if tree.Entropy() > 0.01 {
+		t.Fatalf("Dominated entropy is %f, want near 0", tree.Entropy())
+	}
+}
+
+func TestTree_Coverage(t *testing.T) {
+	tree := BuildRandomTree(100, 1)
+	tree.Remove(10)
+	tree.Put(3, 1000)
+	covered, gaps := tree.Coverage()
+	assert.Equal(t, covered, tree.Total(), "Wrong covered weight")
+	assert.Equal(t, gaps, 0, "Standard tree has gaps")
+
+	tree.Root.Value += 5
+	_, gaps = tree.Coverage()
+	assert.Equal(t, gaps, 5, "Corrupted sum not detected")
+}
+
+func TestTree_DeadKeys(t *testing.T) {
+	tree := BuildRandomTree(100, 1)
+	assert.Equal(t, tree.DeadKeys(), []int{}, "Dead keys in standard tree")
+
+	// Zero and negative weights bypassing validation
+	tree.Put(7, 0)
+	n := tree.leaf(42)
+	n.addBranch(-n.Value - 3)
+	assert.Equal(t, tree.DeadKeys(), []int{7, 42}, "Dead keys not detected")
+	for point := 0; point < tree.Total(); point++ {
+		key, _ := tree.Find(point)
+		if key == 7 || key == 42 {
+			t.Fatalf("Found dead key %d", key)
+		}
+	}
+}
+
+func TestTree_WeightHistogram(t *testing.T) {
+	var tree Tree
+	assert.Equal(t, tree.WeightHistogram(4) == nil, true, "Histogram of empty tree")
+	tree.Put(0, 5)
+	tree.Put(1, 5)
+	assert.Equal(t, tree.WeightHistogram(4) == nil, true, "Histogram of single weight")
+
+	// Buckets [0,25), [25,50), [50,75), [75,100]
+	for key, size := range []int{0, 10, 24, 25, 60, 74, 99, 100} {
+		tree.Put(key, size+1)
+	}
+	assert.Equal(t, tree.WeightHistogram(4), []int{3, 1, 2, 2}, "Wrong bucket counts")
+	assert.Equal(t, tree.WeightHistogram(1), []int{8}, "Wrong bucket counts")
+}
+
+func TestTree_ExpectedCoverageDraws(t *testing.T) {
+	var tree Tree
+	assert.Equal(t, tree.ExpectedCoverageDraws(), 0.0, "Draws for empty tree")
+	tree.Put(0, 7)
+	assert.Equal(t, tree.ExpectedCoverageDraws(), 1.0, "Draws for single key")
+
+	// 1/p0 + 1/p1 - 1/(p0+p1) with p0=1/3 and p1=2/3
+	tree.Put(0, 1)
+	tree.Put(1, 2)
+	if got := tree.ExpectedCoverageDraws(); math.Abs(got-3.5) > 1e-6 {
+		t.Fatalf("Expected %f draws, want 3.5", got)
+	}
+
+	// Uniform weights reduce to n·H(n)
+	var uniform Tree
+	var want float64
+	for key := 1; key <= 10; key++ {
+		uniform.Put(key, 3)
+		want += 10 / float64(key)
+	}
+	if got := uniform.ExpectedCoverageDraws(); math.Abs(got-want) > 1e-6 {
+		t.Fatalf("Expected %f draws, want %f", got, want)
+	}
+
+	// Zero weights are never drawn and not counted
+	uniform.Put(20, 1)
+	uniform.SoftRemove(20)
+	if got := uniform.ExpectedCoverageDraws(); math.Abs(got-want) > 1e-6 {
+		t.Fatalf("Expected %f draws with zero weight, want %f", got, want)
+	}
+	tree.SoftRemove(0)
+	assert.Equal(t, tree.ExpectedCoverageDraws(), 1.0, "Draws for single positive key")
+	tree.SoftRemove(1)
+	assert.Equal(t, tree.ExpectedCoverageDraws(), 0.0, "Draws for zero weights")
+}
+
+func TestTree_Balance(t *testing.T) {
+	var tree Tree
+	assert.Equal(t, tree.Balance(), 1.0, "Wrong balance of empty tree")
+	tree.Put(0, 1)
+	assert.Equal(t, tree.Balance(), 1.0, "Wrong balance of single leaf")
+
+	for key := 1; key < 64; key++ {
+		tree.Put(key, 1)
+	}
+	// A chain of 64 leaves versus the optimal height of 7
+	assert.Equal(t, tree.Balance(), 7.0/64, "Wrong balance of chain")
+
+	tree.Rebuild()
+	assert.Equal(t, tree.Balance(), 1.0, "Wrong balance after rebuild")
+	tree.Put(64, 1)
+	tree.Rebuild()
+	assert.Equal(t, tree.Balance(), 1.0, "Wrong balance after rebuild")
+}
+
+func TestTree_KeysAbove(t *testing.T) {
+	var tree Tree
+	tree.Put(4, 10)
+	tree.Put(0, 1)
+	tree.Put(3, 6)
+	tree.Put(1, 5)
+	tree.Put(2, 7)
+
+	assert.Equal(t, tree.KeysAbove(5), []int{2, 3, 4}, "Wrong heavy keys")
+	assert.Equal(t, tree.KeysAbove(0), []int{0, 1, 2, 3, 4}, "Wrong heavy keys")
+	assert.Equal(t, tree.KeysAbove(10), []int{}, "Wrong heavy keys")
+}
+
+func TestTree_WeightToReach(t *testing.T) {
+	var tree Tree
+	assert.Equal(t, tree.WeightToReach(10), 10, "Wrong weight for empty tree")
+	tree.Put(0, 4)
+	tree.Put(1, 6)
+	assert.Equal(t, tree.WeightToReach(25), 15, "Wrong weight below target")
+	assert.Equal(t, tree.WeightToReach(10), 0, "Wrong weight at target")
+	assert.Equal(t, tree.WeightToReach(3), 0, "Wrong weight above target")
+}
+
+func TestTree_HeavyHitters(t *testing.T) {
+	var tree Tree
+	assert.Equal(t, tree.HeavyHitters(0.5), []int(nil), "Heavy hitters of empty tree")
+	for key, size := range []int{5, 50, 2, 30, 1, 10, 2} {
+		tree.Put(key, size)
+	}
+	assert.Equal(t, tree.HeavyHitters(0.5), []int{1}, "Wrong heavy hitters at half")
+	assert.Equal(t, tree.HeavyHitters(0.8), []int{1, 3}, "Wrong heavy hitters at 80%")
+	assert.Equal(t, tree.HeavyHitters(0.81), []int{1, 3, 5}, "Wrong heavy hitters above 80%")
+	assert.Equal(t, tree.HeavyHitters(1), []int{1, 3, 5, 0, 2, 6, 4}, "Wrong heavy hitters for all weight")
+	assert.Equal(t, tree.HeavyHitters(0), []int(nil), "Accepted zero fraction")
+	assert.Equal(t, tree.HeavyHitters(1.5), []int(nil), "Accepted fraction above one")
+}
+
+func TestTree_MaxShare(t *testing.T) {
+	var tree Tree
+	{
+		_, _, ok := tree.MaxShare()
+		assert.Equal(t, ok, false, "Max share of empty tree")
+	}
+	for key := 0; key < 10; key++ {
+		tree.Put(key, 5)
+	}
+	tree.Put(7, 45)
+	key, share, ok := tree.MaxShare()
+	assert.Equal(t, ok, true, "No max share of non-empty tree")
+	assert.Equal(t, key, 7, "Wrong heaviest key")
+	assert.Equal(t, share, 0.5, "Wrong share")
+
+	tree.Put(7, 5)
+	key, share, _ = tree.MaxShare()
+	assert.Equal(t, [2]interface{}{key, share}, [2]interface{}{0, 0.1}, "Wrong max share on tie")
+}
@@ -0,0 +1,23 @@
+package soseg
+
+// SetStepCounting makes Find, Get and Put count the nodes they visit,
+// for tests asserting that lookups stay O(log n).
+// Lookups write the count to the tree, so concurrent reads are not safe
+// while step counting is enabled.
+func (t *Tree) SetStepCounting(enable bool) {
+	t.stepCounting = enable
+	t.steps = 0
+}
+
+// LastOpSteps returns the number of nodes visited by the descent of the last
+// Find, Get or Put, or 0 if step counting is disabled.
+// Lookups that fail without a descent leave it unchanged.
+func (t *Tree) LastOpSteps() int {
+	return t.steps
+}
+
+func (t *Tree) setSteps(n int) {
+	if t.stepCounting {
+		t.steps = n
+	}
+}
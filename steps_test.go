@@ -0,0 +1,42 @@
+package soseg
+
+import (
+	"github.com/magiconair/properties/assert"
+	"testing"
+)
+
+func TestTree_LastOpSteps(t *testing.T) {
+	tree := BuildRandomTree(10000, 1)
+	tree.Rebuild()
+	tree.Find(0)
+	assert.Equal(t, tree.LastOpSteps(), 0, "Counted steps while disabled")
+
+	tree.SetStepCounting(true)
+	for point := 0; point < tree.Total(); point += 997 {
+		tree.Find(point)
+		if steps := tree.LastOpSteps(); steps < 14 || steps >= 30 {
+			t.Fatalf("Find visited %d nodes of a balanced tree", steps)
+		}
+	}
+	for key := 0; key < 10000; key += 97 {
+		tree.Get(key)
+		if steps := tree.LastOpSteps(); steps >= 30 {
+			t.Fatalf("Get visited %d nodes of a balanced tree", steps)
+		}
+		tree.Put(key, 1)
+		if steps := tree.LastOpSteps(); steps >= 30 {
+			t.Fatalf("Put visited %d nodes of a balanced tree", steps)
+		}
+	}
+
+	var chain Tree
+	chain.SetStepCounting(true)
+	for key := 0; key < 100; key++ {
+		chain.Put(key, 1)
+	}
+	chain.Find(99)
+	assert.Equal(t, chain.LastOpSteps(), 100, "Wrong steps in chain")
+
+	tree.SetStepCounting(false)
+	assert.Equal(t, tree.LastOpSteps(), 0, "Steps not reset")
+}
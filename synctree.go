@@ -0,0 +1,110 @@
+package soseg
+
+import (
+	"math/rand"
+	"sync"
+)
+
+// SyncTree is a Tree guarded by a read-write mutex.
+// Reads run in parallel, writes are exclusive.
+type SyncTree struct {
+	mu   sync.RWMutex
+	tree Tree
+}
+
+var _ Reader = (*SyncTree)(nil)
+
+// Put is the concurrent version of Tree.Put.
+func (s *SyncTree) Put(key int, size int) (created bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.tree.Put(key, size)
+}
+
+// Remove is the concurrent version of Tree.Remove.
+func (s *SyncTree) Remove(key int) (ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.tree.Remove(key)
+}
+
+// ApplyBatch applies all puts and then all removes under a single write lock,
+// so concurrent readers see the tree either before or after the whole batch.
+// It returns how many puts created a key and how many removed keys existed.
+func (s *SyncTree) ApplyBatch(puts []Entry, removes []int) (created, removed int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, e := range puts {
+		if s.tree.Put(e.Key, e.Size) {
+			created++
+		}
+	}
+	for _, key := range removes {
+		if s.tree.Remove(key) {
+			removed++
+		}
+	}
+	return created, removed
+}
+
+// Clear is the concurrent version of Tree.Clear.
+func (s *SyncTree) Clear() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tree.Clear()
+}
+
+// Get is the concurrent version of Tree.Get.
+func (s *SyncTree) Get(key int) (size int, offset int, ok bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.tree.Get(key)
+}
+
+// Find is the concurrent version of Tree.Find.
+func (s *SyncTree) Find(point int) (key int, ok bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.tree.Find(point)
+}
+
+// Total is the concurrent version of Tree.Total.
+func (s *SyncTree) Total() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.tree.Total()
+}
+
+// Size is the concurrent version of Tree.Size.
+func (s *SyncTree) Size() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.tree.Size()
+}
+
+// SampleLocked is the concurrent version of Tree.Sample.
+// The total, the random draw and the descent all happen under one read lock,
+// so the sample is consistent with a single version of the tree.
+// r itself is not synchronized and must not be shared between goroutines.
+func (s *SyncTree) SampleLocked(r *rand.Rand) (int, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.tree.Sample(r)
+}
+
+// ForEachSnapshot calls fn for each entry in key order until fn returns false.
+// It iterates over a copy of the tree taken under the read lock,
+// so writers are only blocked while copying, not while fn runs,
+// and fn may even modify the tree without affecting the iteration.
+// The copy costs O(n) time and memory.
+func (s *SyncTree) ForEachSnapshot(fn func(key, size, offset int) bool) {
+	s.mu.RLock()
+	snap := s.tree.Clone()
+	s.mu.RUnlock()
+
+	for _, e := range snap.Entries() {
+		if !fn(e.Key, e.Size, e.Offset) {
+			return
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package soseg
+
+import (
+	"github.com/magiconair/properties/assert"
+	"math/rand"
+	"sync"
+	"testing"
+)
+
+func TestSyncTree_SampleLocked(t *testing.T) {
+	var s SyncTree
+	for key := 0; key < 100; key++ {
+		s.Put(key, 1)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			r := rand.New(rand.NewSource(seed))
+			for j := 0; j < 1000; j++ {
+				key, ok := s.SampleLocked(r)
+				if !ok || key < 0 || key >= 200 {
+					t.Errorf("Sampled invalid key %d", key)
+				}
+			}
+		}(int64(i))
+	}
+	for key := 100; key < 200; key++ {
+		s.Put(key, 2)
+		s.Remove(key - 100)
+	}
+	wg.Wait()
+
+	assert.Equal(t, s.Size(), 100, "Wrong number of nodes")
+	assert.Equal(t, s.Total(), 200, "Wrong total amount")
+}
+
+func TestSyncTree_ApplyBatch(t *testing.T) {
+	var s SyncTree
+	var low, high []Entry
+	var lowKeys, highKeys []int
+	for key := 0; key < 100; key++ {
+		low = append(low, Entry{Key: key, Size: 1})
+		lowKeys = append(lowKeys, key)
+		high = append(high, Entry{Key: key + 100, Size: 2})
+		highKeys = append(highKeys, key+100)
+	}
+	{
+		created, removed := s.ApplyBatch(low, []int{500})
+		assert.Equal(t, [2]int{created, removed}, [2]int{100, 0}, "Wrong batch counts")
+	}
+
+	// Readers only ever see all low or all high keys
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				if total := s.Total(); total != 100 && total != 200 {
+					t.Errorf("Observed half-applied batch with total %d", total)
+					return
+				}
+			}
+		}()
+	}
+	for i := 0; i < 200; i++ {
+		created, removed := s.ApplyBatch(high, lowKeys)
+		assert.Equal(t, [2]int{created, removed}, [2]int{100, 100}, "Wrong batch counts")
+		s.ApplyBatch(low, highKeys)
+	}
+	close(done)
+	wg.Wait()
+	assert.Equal(t, s.Total(), 100, "Wrong total after batches")
+}
+
+func TestSyncTree_ForEachSnapshot(t *testing.T) {
+	var s SyncTree
+	s.Put(0, 1)
+	s.Put(1, 3)
+	s.Put(2, 4)
+
+	var got []Entry
+	s.ForEachSnapshot(func(key, size, offset int) bool {
+		// Would deadlock if the iteration held the lock
+		s.Put(key+10, 100)
+		s.Remove(2)
+		got = append(got, Entry{Key: key, Size: size, Offset: offset})
+		return true
+	})
+	assert.Equal(t, got, []Entry{{0, 1, 0}, {1, 3, 1}, {2, 4, 4}}, "Snapshot affected by mutation")
+	assert.Equal(t, s.Size(), 5, "Mutations during iteration lost")
+
+	var count int
+	s.ForEachSnapshot(func(key, size, offset int) bool {
+		count++
+		return count < 2
+	})
+	assert.Equal(t, count, 2, "Iteration did not stop")
+}
@@ -0,0 +1,68 @@
+package soseg
+
+import (
+	"bytes"
+	"encoding"
+	"sort"
+	"strconv"
+)
+
+var (
+	_ encoding.TextMarshaler   = (*Tree)(nil)
+	_ encoding.TextUnmarshaler = (*Tree)(nil)
+)
+
+// MarshalText encodes the entries as one "key size" line each in key order,
+// including keys with zero weight left by SoftRemove.
+// Equal trees encode to the same text, which diffs line by line.
+func (t *Tree) MarshalText() ([]byte, error) {
+	var buf []byte
+	t.each(func(key, size int) bool {
+		buf = strconv.AppendInt(buf, int64(key), 10)
+		buf = append(buf, ' ')
+		buf = strconv.AppendInt(buf, int64(size), 10)
+		buf = append(buf, '\n')
+		return true
+	})
+	return buf, nil
+}
+
+// UnmarshalText replaces the contents of the tree with the entries
+// parsed from the output of MarshalText, building a balanced tree.
+// Lines may appear in any order and empty lines are ignored.
+// The tree is left unchanged on error.
+func (t *Tree) UnmarshalText(text []byte) error {
+	var entries []Entry
+	for i, line := range bytes.Split(text, []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		fields := bytes.Fields(line)
+		if len(fields) != 2 {
+			return errorf(ErrCorrupt, "soseg: text: line %d: want 2 fields, got %d", i+1, len(fields))
+		}
+		key, err := strconv.Atoi(string(fields[0]))
+		if err != nil {
+			return errorf(ErrCorrupt, "soseg: text: line %d: invalid key %q", i+1, fields[0])
+		}
+		size, err := strconv.Atoi(string(fields[1]))
+		if err != nil {
+			return errorf(ErrCorrupt, "soseg: text: line %d: invalid size %q", i+1, fields[1])
+		}
+		if size < 0 {
+			return errorf(ErrNonPositiveWeight, "soseg: text: line %d: negative size %d", i+1, size)
+		}
+		entries = append(entries, Entry{Key: key, Size: size})
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return t.lt(entries[i].Key, entries[j].Key)
+	})
+	for i := 1; i < len(entries); i++ {
+		if !t.lt(entries[i-1].Key, entries[i].Key) {
+			return errorf(ErrDuplicateKey, "soseg: text: duplicate key %d", entries[i].Key)
+		}
+	}
+	t.replace(entries)
+	return nil
+}
@@ -0,0 +1,56 @@
+package soseg
+
+import (
+	"errors"
+	"github.com/magiconair/properties/assert"
+	"testing"
+)
+
+func TestTree_MarshalText(t *testing.T) {
+	var tree Tree
+	tree.Put(3, 30)
+	tree.Put(-1, 5)
+	tree.Put(7, 1)
+	text, err := tree.MarshalText()
+	assert.Equal(t, err, nil, "Could not marshal")
+	assert.Equal(t, string(text), "-1 5\n3 30\n7 1\n", "Wrong text")
+
+	var decoded Tree
+	assert.Equal(t, decoded.UnmarshalText(text), nil, "Could not unmarshal")
+	assert.Equal(t, decoded.Equal(&tree), true, "Round trip changed entries")
+
+	// Reordered lines decode to the same tree and text
+	var reordered Tree
+	assert.Equal(t, reordered.UnmarshalText([]byte("7 1\n\n-1 5\n3 30")), nil, "Could not unmarshal reordered lines")
+	assert.Equal(t, reordered.Equal(&tree), true, "Reordered lines changed entries")
+	again, _ := reordered.MarshalText()
+	assert.Equal(t, again, text, "Equal trees marshal differently")
+
+	// Soft-removed keys keep their zero weight
+	tree.SoftRemove(3)
+	text, _ = tree.MarshalText()
+	assert.Equal(t, string(text), "-1 5\n3 0\n7 1\n", "Wrong text with soft-removed key")
+	assert.Equal(t, decoded.UnmarshalText(text), nil, "Could not unmarshal soft-removed key")
+	assert.Equal(t, decoded.Equal(&tree), true, "Round trip changed soft-removed key")
+
+	big := BuildRandomTree(1000, 1)
+	text, _ = big.MarshalText()
+	assert.Equal(t, decoded.UnmarshalText(text), nil, "Could not unmarshal large tree")
+	assert.Equal(t, decoded.Equal(big), true, "Round trip changed large tree")
+
+	for _, c := range []struct {
+		text string
+		kind error
+	}{
+		{"1", ErrCorrupt},
+		{"1 2 3", ErrCorrupt},
+		{"x 2", ErrCorrupt},
+		{"1 y", ErrCorrupt},
+		{"1 -1", ErrNonPositiveWeight},
+		{"1 2\n1 3", ErrDuplicateKey},
+	} {
+		err := decoded.UnmarshalText([]byte(c.text))
+		assert.Equal(t, errors.Is(err, c.kind), true, "Wrong error for "+c.text)
+	}
+	assert.Equal(t, decoded.Equal(big), true, "Failed unmarshal changed tree")
+}
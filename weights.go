@@ -0,0 +1,185 @@
+package soseg
+
+import (
+	"math"
+	"math/bits"
+	"sort"
+)
+
+// QuantizeWeights converts float weights into integer tree weights
+// by multiplying them with scale and rounding to the nearest integer.
+// Positive weights that would round to zero are bumped to 1,
+// so that every key stays selectable.
+// Weights must be positive and finite.
+func QuantizeWeights(weights []float64, scale int) ([]int, error) {
+	if scale <= 0 {
+		return nil, errorf(ErrOutOfRange, "soseg: non-positive scale %d", scale)
+	}
+	sizes := make([]int, len(weights))
+	for i, w := range weights {
+		if !(w > 0) {
+			return nil, errorf(ErrNonPositiveWeight, "soseg: invalid weight %v at index %d", w, i)
+		}
+		if math.IsInf(w, 0) {
+			return nil, errorf(ErrOverflow, "soseg: invalid weight %v at index %d", w, i)
+		}
+		q := math.Round(w * float64(scale))
+		if q >= math.MaxInt {
+			return nil, errorf(ErrOverflow, "soseg: weight %v at index %d overflows", w, i)
+		}
+		sizes[i] = int(q)
+		if sizes[i] == 0 {
+			sizes[i] = 1
+		}
+	}
+	return sizes, nil
+}
+
+// Normalize rescales all weights proportionally so that Total() equals target.
+// Rounding uses largest-remainder apportionment, ties going to the smaller key,
+// so the new total is exact.
+// Zero weights of soft-removed keys stay zero.
+// It fails without changing the tree if the tree is empty or only has zero weights,
+// target is not positive or any positive weight would round down to zero.
+func (t *Tree) Normalize(target int) error {
+	if target <= 0 {
+		return errorf(ErrOutOfRange, "soseg: non-positive target %d", target)
+	}
+	if t.Root == nil {
+		return errorf(ErrEmpty, "soseg: normalize empty tree")
+	}
+	if t.Total() == 0 {
+		return errorf(ErrOutOfRange, "soseg: normalize tree with zero total")
+	}
+	return t.apportion(target)
+}
+
+// apportion rescales all weights proportionally to sum up to target in O(n log n).
+// Key ranges are split into single keys first, since their keys can round differently.
+func (t *Tree) apportion(target int) error {
+	total := uint64(t.Total())
+	leaves := make([]*Node, 0, t.size)
+	split := false
+	t.leaves(func(n *Node) bool {
+		leaves = append(leaves, n)
+		split = split || n.span > 0
+		return true
+	})
+	if split {
+		t.build(t.Entries())
+		return t.apportion(target)
+	}
+
+	// The products can exceed 64 bits, but the quotients fit
+	// since no weight exceeds the total.
+	sizes := make([]int, len(leaves))
+	rems := make([]uint64, len(leaves))
+	sum := 0
+	for i, n := range leaves {
+		hi, lo := bits.Mul64(uint64(n.Value), uint64(target))
+		quo, rem := bits.Div64(hi, lo, total)
+		sizes[i], rems[i] = int(quo), rem
+		sum += int(quo)
+	}
+
+	// Zero weights of soft-removed keys stay zero
+	order := make([]int, 0, len(leaves))
+	for i, n := range leaves {
+		if n.Value > 0 {
+			order = append(order, i)
+		}
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return rems[order[a]] > rems[order[b]]
+	})
+	for _, i := range order[:target-sum] {
+		sizes[i]++
+	}
+
+	for i, size := range sizes {
+		if size <= 0 && leaves[i].Value > 0 {
+			return errorf(ErrNonPositiveWeight, "soseg: weight of key %d rounds to zero", leaves[i].Key)
+		}
+	}
+	for i, n := range leaves {
+		if n.Value != sizes[i] {
+			n.Value = sizes[i]
+			t.record(Op{Kind: OpPut, Key: n.Key, Size: n.Value})
+		}
+	}
+	t.Root.resum()
+	return nil
+}
+
+// Scale multiplies all weights by numerator/denominator.
+// The new total is floor(Total()*numerator/denominator),
+// with remainders distributed like in Normalize.
+// It fails without changing the tree if the factor is not positive,
+// the new total overflows or any weight would drop to zero.
+func (t *Tree) Scale(numerator, denominator int) error {
+	if denominator == 0 {
+		return errorf(ErrOutOfRange, "soseg: zero denominator")
+	}
+	if numerator <= 0 || denominator < 0 {
+		return errorf(ErrOutOfRange, "soseg: non-positive scale factor %d/%d", numerator, denominator)
+	}
+	// Scaling zero weights leaves them zero
+	if t.Root == nil || t.Total() == 0 {
+		return nil
+	}
+	hi, lo := bits.Mul64(uint64(t.Total()), uint64(numerator))
+	if hi >= uint64(denominator) {
+		return errorf(ErrOverflow, "soseg: scaled total overflows")
+	}
+	target, _ := bits.Div64(hi, lo, uint64(denominator))
+	if target > math.MaxInt {
+		return errorf(ErrOverflow, "soseg: scaled total overflows")
+	}
+	return t.apportion(int(target))
+}
+
+// PowTransform replaces every weight w with round(w^exp), so that subsequent samples
+// follow the transformed distribution in O(log n) each, unlike SampleTemperature.
+// It mutates the tree. Zero weights of soft-removed keys stay zero.
+// It fails without changing the tree if any positive weight would drop
+// to zero or the total would overflow.
+func (t *Tree) PowTransform(exp float64) error {
+	var leaves []*Node
+	var sizes []int
+	var total float64
+	var err error
+	t.leaves(func(n *Node) bool {
+		if n.Value == 0 {
+			return true
+		}
+		w := math.Round(math.Pow(float64(n.per()), exp))
+		total += w * float64(n.span+1)
+		switch {
+		case !(w >= 1):
+			err = errorf(ErrNonPositiveWeight, "soseg: weight of key %d drops to zero", n.Key)
+		case total >= math.MaxInt:
+			err = errorf(ErrOverflow, "soseg: transformed total overflows")
+		}
+		leaves = append(leaves, n)
+		sizes = append(sizes, int(w)*(n.span+1))
+		return err == nil
+	})
+	if err != nil {
+		return err
+	}
+	for i, n := range leaves {
+		if n.Value == sizes[i] {
+			continue
+		}
+		n.Value = sizes[i]
+		if n.span > 0 {
+			t.record(Op{Kind: OpPutRange, Key: n.Key, Last: n.last(), Size: n.per()})
+		} else {
+			t.record(Op{Kind: OpPut, Key: n.Key, Size: n.Value})
+		}
+	}
+	if t.Root != nil {
+		t.Root.resum()
+	}
+	return nil
+}
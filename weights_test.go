@@ -0,0 +1,160 @@
+package soseg
+
+import (
+	"errors"
+	"github.com/magiconair/properties/assert"
+	"math"
+	"testing"
+)
+
+func TestQuantizeWeights(t *testing.T) {
+	weights := []float64{0.5, 0.25, 0.125, 0.1, 0.025, 0.0001}
+	sizes, err := QuantizeWeights(weights, 1000)
+	assert.Equal(t, err, nil, "Could not quantize")
+	assert.Equal(t, sizes, []int{500, 250, 125, 100, 25, 1}, "Wrong quantized weights")
+
+	var sum float64
+	var total int
+	for i := range weights {
+		sum += weights[i]
+		total += sizes[i]
+	}
+	for i := range weights {
+		want := weights[i] / sum
+		got := float64(sizes[i]) / float64(total)
+		// Half a unit of rounding plus the bumped weight
+		if math.Abs(got-want) > 2.0/float64(total) {
+			t.Fatalf("Proportion of weight %d is %f, want %f", i, got, want)
+		}
+	}
+
+	for _, bad := range [][]float64{{1, 0}, {-1}, {math.NaN()}, {math.Inf(1)}, {math.MaxFloat64}} {
+		_, err := QuantizeWeights(bad, 1000)
+		assert.Equal(t, err != nil, true, "Accepted invalid weight")
+	}
+	{
+		_, err := QuantizeWeights(weights, 0)
+		assert.Equal(t, err != nil, true, "Accepted non-positive scale")
+	}
+}
+
+func TestTree_Normalize(t *testing.T) {
+	var tree Tree
+	assert.Equal(t, tree.Normalize(100) != nil, true, "Normalized empty tree")
+
+	tree.Put(0, 1)
+	tree.Put(1, 1)
+	tree.Put(2, 1)
+	tree.Put(3, 7)
+	assert.Equal(t, tree.Normalize(0) != nil, true, "Accepted non-positive target")
+
+	assert.Equal(t, tree.Normalize(101), nil, "Could not normalize")
+	assert.Equal(t, tree.Total(), 101, "Wrong total after normalize")
+	_, sizes := tree.Columns()
+	// Quotas are 10.1 each and 70.7, the remaining unit goes to the largest remainder
+	assert.Equal(t, sizes, []int{10, 10, 10, 71}, "Wrong normalized weights")
+	{
+		_, offset, _ := tree.Get(3)
+		assert.Equal(t, offset, 30, "Got wrong offset")
+	}
+
+	assert.Equal(t, tree.Normalize(3) != nil, true, "Accepted weights rounding to zero")
+	assert.Equal(t, tree.Total(), 101, "Tree changed by failed normalize")
+
+	big := BuildRandomTree(1000, 1)
+	assert.Equal(t, big.Normalize(1<<40), nil, "Could not normalize")
+	assert.Equal(t, big.Total(), 1<<40, "Wrong total after normalize")
+
+	zero := new(Tree)
+	zero.Put(0, 1)
+	zero.SoftRemove(0)
+	err := zero.Normalize(100)
+	assert.Equal(t, errors.Is(err, ErrOutOfRange), true, "Normalized zero weights")
+	assert.Equal(t, zero.Total(), 0, "Tree changed by failed normalize")
+
+	// Soft-removed keys keep their zero weight
+	mixed := new(Tree)
+	mixed.Put(0, 1)
+	mixed.Put(1, 2)
+	mixed.Put(2, 1)
+	mixed.SoftRemove(1)
+	assert.Equal(t, mixed.Normalize(7), nil, "Could not normalize soft-removed key")
+	_, sizes = mixed.Columns()
+	// Quotas are 3.5 and 3.5, the tie goes to the smaller key
+	assert.Equal(t, sizes, []int{4, 0, 3}, "Wrong normalized weights with soft-removed key")
+}
+
+func TestTree_Scale(t *testing.T) {
+	var tree Tree
+	tree.Put(0, 2)
+	tree.Put(1, 3)
+	tree.Put(2, 5)
+	tree.Put(3, 1)
+
+	assert.Equal(t, tree.Scale(3, 2), nil, "Could not scale")
+	assert.Equal(t, tree.Total(), 16, "Wrong total after scale")
+	_, sizes := tree.Columns()
+	// Quotas are 2.91, 4.36, 7.27 and 1.45
+	assert.Equal(t, sizes, []int{3, 4, 7, 2}, "Wrong scaled weights")
+
+	assert.Equal(t, tree.Scale(1, 0) != nil, true, "Accepted zero denominator")
+	assert.Equal(t, tree.Scale(-1, 2) != nil, true, "Accepted negative factor")
+	assert.Equal(t, tree.Scale(1, 100) != nil, true, "Accepted weights dropping to zero")
+	assert.Equal(t, tree.Scale(math.MaxInt, 1) != nil, true, "Accepted overflowing total")
+	assert.Equal(t, tree.Total(), 16, "Tree changed by failed scale")
+	for _, size := range sizes {
+		assert.Equal(t, size > 0, true, "Weight dropped to zero")
+	}
+
+	zero := new(Tree)
+	zero.Put(0, 1)
+	zero.Put(1, 1)
+	zero.SoftRemove(0)
+	zero.SoftRemove(1)
+	assert.Equal(t, zero.Scale(3, 2), nil, "Could not scale zero weights")
+	assert.Equal(t, zero.Total(), 0, "Zero weights changed by scale")
+
+	var mixed Tree
+	mixed.Put(1, 5)
+	mixed.Put(2, 7)
+	mixed.Put(3, 9)
+	mixed.SoftRemove(2)
+	assert.Equal(t, mixed.Scale(2, 1), nil, "Could not scale soft-removed key")
+	_, sizes = mixed.Columns()
+	assert.Equal(t, sizes, []int{10, 0, 18}, "Wrong scaled weights with soft-removed key")
+}
+
+func TestTree_PowTransform(t *testing.T) {
+	var tree Tree
+	tree.Put(0, 1)
+	tree.Put(1, 2)
+	tree.Put(2, 3)
+	tree.Put(3, 4)
+
+	assert.Equal(t, tree.PowTransform(2), nil, "Could not transform")
+	_, sizes := tree.Columns()
+	assert.Equal(t, sizes, []int{1, 4, 9, 16}, "Wrong squared weights")
+	assert.Equal(t, tree.Total(), 30, "Wrong total amount")
+	{
+		_, offset, _ := tree.Get(3)
+		assert.Equal(t, offset, 14, "Got wrong offset")
+	}
+
+	assert.Equal(t, tree.PowTransform(0.5), nil, "Could not transform")
+	_, sizes = tree.Columns()
+	assert.Equal(t, sizes, []int{1, 2, 3, 4}, "Wrong rooted weights")
+
+	assert.Equal(t, tree.PowTransform(-1) != nil, true, "Accepted weights dropping to zero")
+	assert.Equal(t, tree.PowTransform(100) != nil, true, "Accepted overflowing total")
+	assert.Equal(t, tree.Total(), 10, "Tree changed by failed transform")
+
+	// Soft-removed keys stay dead
+	tree.SoftRemove(1)
+	assert.Equal(t, tree.PowTransform(2), nil, "Could not transform soft-removed key")
+	_, sizes = tree.Columns()
+	assert.Equal(t, sizes, []int{1, 0, 9, 16}, "Wrong squared weights with soft-removed key")
+	assert.Equal(t, tree.PowTransform(0), nil, "Could not transform soft-removed key")
+	_, sizes = tree.Columns()
+	assert.Equal(t, sizes, []int{1, 0, 1, 1}, "Wrong constant weights with soft-removed key")
+	assert.Equal(t, tree.DeadKeys(), []int{1}, "Soft-removed key revived")
+}